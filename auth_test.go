@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+type staticCredential struct {
+	err error
+}
+
+func (c staticCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "t", ExpiresOn: time.Now().Add(time.Hour)}, c.err
+}
+
+func TestGetTokenNamingSource(t *testing.T) {
+	opts := policy.TokenRequestOptions{Scopes: []string{"https://acct.documents.azure.com/.default"}}
+
+	chain, err := azidentity.NewChainedTokenCredential([]azcore.TokenCredential{staticCredential{}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, used, err := getTokenNamingSource(context.Background(), chain, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(used, "staticCredential") {
+		t.Errorf("a chain authenticated with %q, want the staticCredential in it", used)
+	}
+
+	_, used, err = getTokenNamingSource(context.Background(), staticCredential{}, opts)
+	if err != nil || used != "" {
+		t.Errorf("a single credential gave %q, %v, want no source named", used, err)
+	}
+
+	failed := errors.New("no token")
+	_, used, err = getTokenNamingSource(context.Background(), staticCredential{err: failed}, opts)
+	if !errors.Is(err, failed) || used != "" {
+		t.Errorf("a failed credential gave %q, %v", used, err)
+	}
+}
+
+func TestCredentialName(t *testing.T) {
+	cred, err := azidentity.NewChainedTokenCredential([]azcore.TokenCredential{staticCredential{}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := credentialName(cred); got != "ChainedTokenCredential" {
+		t.Errorf("credentialName = %q", got)
+	}
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+)
+
+// The operations a benchmark mixes. They are the quiet equivalents of the
+// menu's getCustomer, QuerySalesOrdersByCustomerId, UpdateSalesOrderQty and
+// DeleteCustomerOrderAndUpdateSalesOrderQty, against the database-v4 layout
+// where a customer and its orders share a partition.
+const (
+	benchRead   = "read"
+	benchQuery  = "query"
+	benchCreate = "create"
+	benchDelete = "delete"
+)
+
+var benchOps = []string{benchRead, benchQuery, benchCreate, benchDelete}
+
+// benchWeight is one entry of a workload mix, e.g. read=70.
+type benchWeight struct {
+	op     string
+	weight int
+}
+
+// parseBenchMix parses a mix such as "read=70,query=20,create=5,delete=5".
+// Weights are relative and needn't add up to 100.
+func parseBenchMix(s string) ([]benchWeight, error) {
+	var mix []benchWeight
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("mix entry %q isn't op=weight", part)
+		}
+		op, weight := fields[0], fields[1]
+		known := false
+		for _, o := range benchOps {
+			known = known || o == op
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown operation %q in mix, expected one of %s", op, strings.Join(benchOps, ", "))
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("weight for %s must be a non-negative number, got %q", op, weight)
+		}
+		if n > 0 {
+			mix = append(mix, benchWeight{op: op, weight: n})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("mix has no operations with a weight above zero")
+	}
+	return mix, nil
+}
+
+func pickBenchOp(rng *rand.Rand, mix []benchWeight) string {
+	total := 0
+	for _, w := range mix {
+		total += w.weight
+	}
+	n := rng.Intn(total)
+	for _, w := range mix {
+		if n < w.weight {
+			return w.op
+		}
+		n -= w.weight
+	}
+	return mix[len(mix)-1].op
+}
+
+// throttleCounter is a pipeline policy counting every attempt and every
+// throttled (429) response. The retry policy hides throttling from callers,
+// so this is the only place it can be seen.
+type throttleCounter struct {
+	attempts  int64
+	throttled int64
+}
+
+func (c *throttleCounter) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	atomic.AddInt64(&c.attempts, 1)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		atomic.AddInt64(&c.throttled, 1)
+	}
+	return resp, err
+}
+
+// benchSample is the outcome of one operation.
+type benchSample struct {
+	op      string
+	latency time.Duration
+	charge  float32
+	err     error
+	// skipped is set for a delete when there is no order left to delete.
+	skipped bool
+}
+
+// benchOpStats summarizes the samples of one operation.
+type benchOpStats struct {
+	Op        string         `json:"op"`
+	Count     int            `json:"count"`
+	Errors    int            `json:"errors"`
+	Throttled int            `json:"throttled"`
+	Skipped   int            `json:"skipped,omitempty"`
+	P50Ms     float64        `json:"p50Ms"`
+	P95Ms     float64        `json:"p95Ms"`
+	P99Ms     float64        `json:"p99Ms"`
+	MeanMs    float64        `json:"meanMs"`
+	RUPerOp   float64        `json:"ruPerOp"`
+	TotalRU   float64        `json:"totalRU"`
+	ErrorKind map[string]int `json:"errorsByKind,omitempty"`
+}
+
+// benchResult is a whole run, in the form written by -out so runs can be
+// compared.
+type benchResult struct {
+	Started      time.Time      `json:"started"`
+	Seconds      float64        `json:"seconds"`
+	Database     string         `json:"database"`
+	Container    string         `json:"container"`
+	Mix          string         `json:"mix"`
+	Concurrency  int            `json:"concurrency"`
+	Rate         float64        `json:"rate,omitempty"`
+	Seed         int64          `json:"seed"`
+	Customers    int            `json:"customers"`
+	Operations   int            `json:"operations"`
+	OpsPerSecond float64        `json:"opsPerSecond"`
+	TotalRU      float64        `json:"totalRU"`
+	RUPerSecond  float64        `json:"ruPerSecond"`
+	Attempts     int64          `json:"attempts"`
+	Throttled    int64          `json:"throttledAttempts"`
+	ThrottleRate float64        `json:"throttleRate"`
+	ByOperation  []benchOpStats `json:"byOperation"`
+}
+
+// benchOrder is an order created by the benchmark, which a later delete
+// removes again.
+type benchOrder struct {
+	customerID string
+	orderID    string
+}
+
+// bencher runs the operations against one container.
+type bencher struct {
+	container *azcosmos.ContainerClient
+	customers []string
+
+	mu     sync.Mutex
+	orders []benchOrder
+}
+
+func (b *bencher) run(ctx context.Context, rng *rand.Rand, op string) benchSample {
+	customerID := b.customers[rng.Intn(len(b.customers))]
+	s := benchSample{op: op}
+	start := time.Now()
+	switch op {
+	case benchRead:
+		s.charge, s.err = b.read(ctx, customerID)
+	case benchQuery:
+		s.charge, s.err = b.query(ctx, customerID)
+	case benchCreate:
+		s.charge, s.err = b.create(ctx, customerID)
+	case benchDelete:
+		order, ok := b.takeOrder(rng)
+		if !ok {
+			s.skipped = true
+			return s
+		}
+		s.charge, s.err = b.delete(ctx, order)
+		if s.err != nil {
+			b.addOrder(order)
+		}
+	}
+	s.latency = time.Since(start)
+	return s
+}
+
+func (b *bencher) read(ctx context.Context, customerID string) (float32, error) {
+	itemResponse, err := b.container.ReadItem(ctx, azcosmos.NewPartitionKeyString(customerID), customerID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return itemResponse.RequestCharge, nil
+}
+
+func (b *bencher) query(ctx context.Context, customerID string) (float32, error) {
+	var charge float32
+	queryPager := b.container.NewQueryItemsPager(salesOrdersQuery, azcosmos.NewPartitionKeyString(customerID), nil)
+	for queryPager.More() {
+		queryResponse, err := queryPager.NextPage(ctx)
+		if err != nil {
+			return charge, err
+		}
+		charge += queryResponse.RequestCharge
+	}
+	return charge, nil
+}
+
+// create adds an order and increments the customer's salesOrderCount in one
+// batch. The replace is conditional on the customer's etag, so concurrent
+// creates for the same customer fail rather than lose a count.
+func (b *bencher) create(ctx context.Context, customerID string) (float32, error) {
+	customer, etag, charge, err := b.readCustomer(ctx, customerID)
+	if err != nil {
+		return charge, err
+	}
+	count, _ := customer["salesOrderCount"].(float64)
+	customer["salesOrderCount"] = count + 1
+
+	orderID := uuid.New().String()
+	now := time.Now().UTC()
+	order := map[string]interface{}{
+		"id":         orderID,
+		"type":       "salesOrder",
+		"customerId": customerID,
+		"orderDate":  formatDate(now),
+		"shipDate":   formatDate(now.AddDate(0, 0, 7)),
+		"details": []interface{}{
+			map[string]interface{}{"sku": "BK-R50B-52", "name": "Road-650 Black, 52", "price": 782.99, "quantity": 1},
+		},
+	}
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return charge, err
+	}
+	batchCharge, err := b.replaceCustomerAfter(ctx, customerID, customer, etag, func(batch *azcosmos.TransactionalBatch) {
+		batch.CreateItem(orderJSON, nil)
+	})
+	charge += batchCharge
+	if err == nil {
+		b.addOrder(benchOrder{customerID: customerID, orderID: orderID})
+	}
+	return charge, err
+}
+
+// delete removes an order created earlier in the run and decrements the
+// customer's salesOrderCount in one batch.
+func (b *bencher) delete(ctx context.Context, order benchOrder) (float32, error) {
+	customer, etag, charge, err := b.readCustomer(ctx, order.customerID)
+	if err != nil {
+		return charge, err
+	}
+	count, _ := customer["salesOrderCount"].(float64)
+	customer["salesOrderCount"] = count - 1
+
+	batchCharge, err := b.replaceCustomerAfter(ctx, order.customerID, customer, etag, func(batch *azcosmos.TransactionalBatch) {
+		batch.DeleteItem(order.orderID, nil)
+	})
+	return charge + batchCharge, err
+}
+
+func (b *bencher) readCustomer(ctx context.Context, customerID string) (map[string]interface{}, azcore.ETag, float32, error) {
+	itemResponse, err := b.container.ReadItem(ctx, azcosmos.NewPartitionKeyString(customerID), customerID, nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	customer := map[string]interface{}{}
+	if err := json.Unmarshal(itemResponse.Value, &customer); err != nil {
+		return nil, "", itemResponse.RequestCharge, err
+	}
+	return customer, itemResponse.ETag, itemResponse.RequestCharge, nil
+}
+
+// replaceCustomerAfter runs a batch of the order operation added by addOp
+// followed by a replace of the customer conditional on etag.
+func (b *bencher) replaceCustomerAfter(ctx context.Context, customerID string, customer map[string]interface{}, etag azcore.ETag, addOp func(batch *azcosmos.TransactionalBatch)) (float32, error) {
+	customerJSON, err := json.Marshal(customer)
+	if err != nil {
+		return 0, err
+	}
+
+	batch := b.container.NewTransactionalBatch(azcosmos.NewPartitionKeyString(customerID))
+	addOp(&batch)
+	batch.ReplaceItem(customerID, customerJSON, &azcosmos.TransactionalBatchItemOptions{IfMatchETag: &etag})
+	batchResponse, err := b.container.ExecuteTransactionalBatch(ctx, batch, nil)
+	if err != nil {
+		return 0, err
+	}
+	if batchResponse.Success {
+		return batchResponse.RequestCharge, nil
+	}
+	return batchResponse.RequestCharge, failedBatchError(batchResponse.OperationResults)
+}
+
+// benchErrorKind names the kind of a failed operation for the report.
+func benchErrorKind(err error) string {
+	var failure *batchFailedError
+	if errors.As(err, &failure) && classifyError(err) == errKindUnknown {
+		return fmt.Sprintf("status %d", failure.StatusCode)
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	return classifyError(err).String()
+}
+
+func (b *bencher) addOrder(order benchOrder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.orders = append(b.orders, order)
+}
+
+func (b *bencher) takeOrder(rng *rand.Rand) (benchOrder, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.orders) == 0 {
+		return benchOrder{}, false
+	}
+	i := rng.Intn(len(b.orders))
+	order := b.orders[i]
+	b.orders[i] = b.orders[len(b.orders)-1]
+	b.orders = b.orders[:len(b.orders)-1]
+	return order, true
+}
+
+// errEnoughCustomers stops the customer scan once it has found enough.
+var errEnoughCustomers = errors.New("enough customers")
+
+// sampleCustomers returns the ids of up to n customers in the container.
+func sampleCustomers(ctx context.Context, rc *restClient, databaseName, containerName string, n int) ([]string, error) {
+	var ids []string
+	err := rc.readItems(ctx, databaseName, containerName, func(raw json.RawMessage) error {
+		item := struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		if item.Type == "customer" {
+			ids = append(ids, item.ID)
+		}
+		if len(ids) >= n {
+			return errEnoughCustomers
+		}
+		return nil
+	})
+	if err != nil && err != errEnoughCustomers {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// tickInterval is the time between operations at rate per second. Tickers
+// need at least a nanosecond, so rates above a billion run flat out, and
+// rates too low to express wait as long as a Duration can.
+func tickInterval(rate float64) time.Duration {
+	interval := float64(time.Second) / rate
+	if interval < 1 {
+		return 1
+	}
+	if interval >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(interval)
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, in
+// milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return milliseconds(sorted[i])
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func summarizeBench(samples []benchSample) []benchOpStats {
+	byOp := map[string][]benchSample{}
+	for _, s := range samples {
+		byOp[s.op] = append(byOp[s.op], s)
+	}
+
+	var stats []benchOpStats
+	for _, op := range benchOps {
+		opSamples, ok := byOp[op]
+		if !ok {
+			continue
+		}
+		st := benchOpStats{Op: op}
+		var latencies []time.Duration
+		var total time.Duration
+		for _, s := range opSamples {
+			if s.skipped {
+				st.Skipped++
+				continue
+			}
+			st.Count++
+			st.TotalRU += float64(s.charge)
+			latencies = append(latencies, s.latency)
+			total += s.latency
+			if s.err != nil {
+				st.Errors++
+				kind := benchErrorKind(s.err)
+				if kind == errKindThrottled.String() {
+					st.Throttled++
+				}
+				if st.ErrorKind == nil {
+					st.ErrorKind = map[string]int{}
+				}
+				st.ErrorKind[kind]++
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		st.P50Ms = percentile(latencies, 50)
+		st.P95Ms = percentile(latencies, 95)
+		st.P99Ms = percentile(latencies, 99)
+		if st.Count > 0 {
+			st.MeanMs = milliseconds(total) / float64(st.Count)
+			st.RUPerOp = st.TotalRU / float64(st.Count)
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+func printBenchResult(r benchResult) {
+	fmt.Printf("\n%d operations in %.1fs against %v\\%v (%.1f ops/s, %.1f RU/s)\n", r.Operations, r.Seconds, r.Database, r.Container, r.OpsPerSecond, r.RUPerSecond)
+	fmt.Printf("%d of %d requests throttled (%.2f%%)\n\n", r.Throttled, r.Attempts, r.ThrottleRate*100)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tcount\terrors\tthrottled\tp50 ms\tp95 ms\tp99 ms\tRU/op\t")
+	for _, s := range r.ByOperation {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f\t%.1f\t%.1f\t%.2f\t\n", s.Op, s.Count, s.Errors, s.Throttled, s.P50Ms, s.P95Ms, s.P99Ms, s.RUPerOp)
+	}
+	w.Flush()
+
+	for _, s := range r.ByOperation {
+		if s.Skipped > 0 {
+			fmt.Printf("%s: %d skipped, no orders created by this run were left\n", s.Op, s.Skipped)
+		}
+		var kinds []string
+		for kind := range s.ErrorKind {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Printf("%s: %d %s\n", s.Op, s.ErrorKind[kind], kind)
+		}
+	}
+}
+
+// runBenchCommand implements `bench [-database name] [-container name] [-mix ops] [-concurrency n] [-rate n] [-duration d] [-ops n] [-out path]`.
+func runBenchCommand(ctx context.Context, opts globalOptions, args []string) error {
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database to run against, in the database-v4 layout")
+	containerName := fs.String("container", p.container("customer"), "container holding customers and their orders")
+	mixFlag := fs.String("mix", "read=70,query=20,create=5,delete=5", "relative weights of read, query, create and delete")
+	concurrency := fs.Int("concurrency", 8, "number of operations in flight at once")
+	rate := fs.Float64("rate", 0, "target operations per second across all workers, 0 for as fast as possible")
+	duration := fs.Duration("duration", 30*time.Second, "how long to run")
+	maxOps := fs.Int("ops", 0, "stop after this many operations, 0 for no limit")
+	customerCount := fs.Int("customers", 100, "number of customers to spread the load over")
+	seed := fs.Int64("seed", 1, "random seed for choosing operations and customers")
+	out := fs.String("out", "", "write the results as JSON to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: bench [-database name] [-container name] [-mix ops] [-concurrency n] [-rate n] [-duration d] [-ops n] [-customers n] [-seed n] [-out path]")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", *concurrency)
+	}
+	if *rate < 0 || math.IsNaN(*rate) || math.IsInf(*rate, 0) || *maxOps < 0 || *customerCount < 1 {
+		return errors.New("rate and ops can't be negative, and customers must be at least 1")
+	}
+	mix, err := parseBenchMix(*mixFlag)
+	if err != nil {
+		return err
+	}
+
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	guard := newSafety(opts, p, rc)
+	var writes bool
+	for _, w := range mix {
+		writes = writes || w.op == benchCreate || w.op == benchDelete
+	}
+	if writes {
+		ok, err := guard.allowWrite(fmt.Sprintf("create and delete sales orders and replace customers in %v\\%v", *databaseName, *containerName))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// a dry run still measures the reads
+			var reads []benchWeight
+			for _, w := range mix {
+				if w.op == benchRead || w.op == benchQuery {
+					reads = append(reads, w)
+				}
+			}
+			if len(reads) == 0 {
+				return nil
+			}
+			mix = reads
+		}
+	}
+
+	counter := &throttleCounter{}
+	client, err := newClient(p, counter)
+	if err != nil {
+		return err
+	}
+	container, err := client.NewContainer(*databaseName, *containerName)
+	if err != nil {
+		return err
+	}
+
+	customers, err := sampleCustomers(ctx, rc, *databaseName, *containerName, *customerCount)
+	if err != nil {
+		return err
+	}
+	if len(customers) == 0 {
+		return fmt.Errorf("no customers found in %v\\%v, load or generate data first", *databaseName, *containerName)
+	}
+	b := &bencher{container: container, customers: customers}
+
+	log.Printf("Benchmarking %v\\%v over %d customers: mix %s, concurrency %d\n", *databaseName, *containerName, len(customers), *mixFlag, *concurrency)
+	runCtx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// with a target rate, workers take a token from the ticker before
+	// every operation
+	var ticks <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(tickInterval(*rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	var (
+		started = time.Now()
+		issued  int64
+		mu      sync.Mutex
+		samples []benchSample
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			for {
+				if ticks != nil {
+					select {
+					case <-ticks:
+					case <-runCtx.Done():
+						return
+					}
+				}
+				if runCtx.Err() != nil {
+					return
+				}
+				if *maxOps > 0 && atomic.AddInt64(&issued, 1) > int64(*maxOps) {
+					return
+				}
+				s := b.run(runCtx, rng, pickBenchOp(rng, mix))
+				// operations cut off by the end of the run aren't counted
+				if errors.Is(s.err, context.DeadlineExceeded) && runCtx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				samples = append(samples, s)
+				mu.Unlock()
+			}
+		}(rand.New(rand.NewSource(*seed + int64(i))))
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := benchResult{
+		Started:     started.UTC(),
+		Seconds:     elapsed.Seconds(),
+		Database:    *databaseName,
+		Container:   *containerName,
+		Mix:         *mixFlag,
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Seed:        *seed,
+		Customers:   len(customers),
+		Attempts:    atomic.LoadInt64(&counter.attempts),
+		Throttled:   atomic.LoadInt64(&counter.throttled),
+		ByOperation: summarizeBench(samples),
+	}
+	for _, s := range result.ByOperation {
+		result.Operations += s.Count
+		result.TotalRU += s.TotalRU
+	}
+	if result.Seconds > 0 {
+		result.OpsPerSecond = float64(result.Operations) / result.Seconds
+		result.RUPerSecond = result.TotalRU / result.Seconds
+	}
+	if result.Attempts > 0 {
+		result.ThrottleRate = float64(result.Throttled) / float64(result.Attempts)
+	}
+	printBenchResult(result)
+	if len(b.orders) > 0 {
+		log.Printf("%d orders created by this run are left in %v\\%v, with salesOrderCount updated to match\n", len(b.orders), *databaseName, *containerName)
+	}
+
+	if *out == "" {
+		return nil
+	}
+	resultJSON, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(resultJSON, '\n'), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Results written to %v\n", *out)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBenchMix(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []benchWeight
+		wantErr string
+	}{
+		{
+			name: "default",
+			in:   "read=70,query=20,create=5,delete=5",
+			want: []benchWeight{{benchRead, 70}, {benchQuery, 20}, {benchCreate, 5}, {benchDelete, 5}},
+		},
+		{name: "spaces", in: " read=1 , create=2", want: []benchWeight{{benchRead, 1}, {benchCreate, 2}}},
+		{name: "zero weights are dropped", in: "read=1,delete=0", want: []benchWeight{{benchRead, 1}}},
+		{name: "all zero", in: "read=0,query=0", wantErr: "no operations"},
+		{name: "unknown operation", in: "read=1,upsert=2", wantErr: `unknown operation "upsert"`},
+		{name: "negative weight", in: "read=-1", wantErr: "non-negative"},
+		{name: "not a number", in: "read=lots", wantErr: "non-negative"},
+		{name: "no weight", in: "read", wantErr: "isn't op=weight"},
+		{name: "empty", in: "", wantErr: "isn't op=weight"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBenchMix(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickBenchOp(t *testing.T) {
+	mix := []benchWeight{{benchRead, 70}, {benchQuery, 20}, {benchCreate, 10}}
+	rng := rand.New(rand.NewSource(1))
+	const n = 100000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		counts[pickBenchOp(rng, mix)]++
+	}
+	for _, w := range mix {
+		share := float64(counts[w.op]) / n * 100
+		if math.Abs(share-float64(w.weight)) > 1 {
+			t.Errorf("%s picked %.1f%% of the time, want about %d%%", w.op, share, w.weight)
+		}
+	}
+	if counts[benchDelete] != 0 {
+		t.Errorf("%s picked %d times, it isn't in the mix", benchDelete, counts[benchDelete])
+	}
+
+	only := []benchWeight{{benchDelete, 3}}
+	for i := 0; i < 100; i++ {
+		if op := pickBenchOp(rng, only); op != benchDelete {
+			t.Fatalf("picked %s from a mix of only %s", op, benchDelete)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   float64
+	}{
+		{name: "empty", sorted: nil, p: 50, want: 0},
+		{name: "single", sorted: []time.Duration{1500 * time.Microsecond}, p: 99, want: 1.5},
+		{name: "p0", sorted: sorted, p: 0, want: 1},
+		{name: "p50", sorted: sorted, p: 50, want: 5},
+		{name: "p55 rounds up", sorted: sorted, p: 55, want: 6},
+		{name: "p95", sorted: sorted, p: 95, want: 10},
+		{name: "p100", sorted: sorted, p: 100, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(p%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeBench(t *testing.T) {
+	throttled := &batchFailedError{StatusCode: http.StatusTooManyRequests}
+	samples := []benchSample{
+		{op: benchRead, latency: 4 * time.Millisecond, charge: 1},
+		{op: benchRead, latency: 2 * time.Millisecond, charge: 1},
+		{op: benchCreate, latency: 10 * time.Millisecond, charge: 20},
+		{op: benchCreate, latency: 30 * time.Millisecond, charge: 0, err: throttled},
+		{op: benchCreate, latency: 20 * time.Millisecond, charge: 0, err: errors.New("boom")},
+		{op: benchDelete, skipped: true},
+	}
+	got := summarizeBench(samples)
+	want := []benchOpStats{
+		{
+			Op: benchRead, Count: 2,
+			P50Ms: 2, P95Ms: 4, P99Ms: 4, MeanMs: 3,
+			RUPerOp: 1, TotalRU: 2,
+		},
+		{
+			Op: benchCreate, Count: 3, Errors: 2, Throttled: 1,
+			P50Ms: 20, P95Ms: 30, P99Ms: 30, MeanMs: 20,
+			RUPerOp: 20.0 / 3, TotalRU: 20,
+			ErrorKind: map[string]int{errKindThrottled.String(): 1, errKindUnknown.String(): 1},
+		},
+		{Op: benchDelete, Skipped: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTickInterval(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want time.Duration
+	}{
+		{rate: 1, want: time.Second},
+		{rate: 100, want: 10 * time.Millisecond},
+		{rate: 1e9, want: time.Nanosecond},
+		{rate: 5e9, want: time.Nanosecond},
+		{rate: 1e-300, want: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		if got := tickInterval(tt.rate); got != tt.want {
+			t.Errorf("tickInterval(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,855 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// browser is a full-screen view of the account: a tree of databases and
+// containers on the left, the items of one partition on the right, and the
+// selected item's JSON below. It redraws the screen after every key: arrows
+// move through the tree or the items, tab switches between them and enter
+// opens what is under the cursor, while keys that need more, such as k for a
+// partition key, ask for it on a prompt line. When stdin isn't a terminal,
+// commands are typed as lines instead.
+type browser struct {
+	client *azcosmos.Client
+	rc     *restClient
+	guard  *safety
+
+	databases  []string
+	containers map[string][]containerInfo // loaded when a database is opened
+	open       map[string]bool
+
+	database  string
+	container containerInfo
+	// partitionKey is the value of the partition listed, nil for none.
+	partitionKey interface{}
+	query        string
+
+	pages   []queryPage
+	current int
+	item    map[string]interface{}
+
+	// status is the last line logged by the operations the browser calls,
+	// which carries the RU charge and activity id.
+	status *lastLine
+
+	// keys is set when single key presses are read, and focus, treeRow and
+	// itemRow are then where the cursor is; itemRow counts from the top of
+	// the current page.
+	keys    bool
+	focus   browserPane
+	treeRow int
+	itemRow int
+}
+
+type browserPane int
+
+const (
+	treePane browserPane = iota
+	itemPane
+)
+
+// lastLine is a log writer that keeps only the most recent line.
+type lastLine struct {
+	line string
+}
+
+func (l *lastLine) Write(p []byte) (int, error) {
+	if s := bytes.TrimSpace(p); len(s) > 0 {
+		lines := strings.Split(string(s), "\n")
+		l.line = strings.TrimSpace(lines[len(lines)-1])
+	}
+	return len(p), nil
+}
+
+const browseKeysHelp = `Keys:
+  up, down       move the cursor in the tree or the items
+  tab            switch between the tree and the items (also left, right)
+  enter          open the database or select the container under the cursor,
+                 or show the item under it with its RU charge and activity id
+  k              list the items of a partition, asks for the key value
+  q              edit the query
+  ]  [           next / previous page of items (also page down, page up)
+  c              create an item, asks for its JSON
+  e              replace the selected item, asks for its JSON
+  s              set one field of the selected item, asks for field=value
+  d              delete the selected item
+  r              refresh
+  ?              help
+  x              back`
+
+const browseHelp = `Commands (press enter after each):
+  <n>            open database or select container <n> in the tree
+  k <value>      list items with partition key <value>
+  q <sql>        edit the query, e.g. q SELECT * FROM c WHERE c.type = 'salesOrder'
+  i<n>           show item <n> with its RU charge and activity id
+  ]  [           next / previous page of items
+  c <json>       create an item
+  e <json>       replace the selected item
+  s field=value  set one field of the selected item (value is JSON, or a string)
+  d              delete the selected item
+  r              refresh
+  ?              help
+  x              back`
+
+// terminalWidth asks the terminal, or takes $COLUMNS when it can't.
+func terminalWidth() int {
+	if n, err := terminalColumns(int(os.Stdout.Fd())); err == nil && n >= 60 {
+		return n
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n >= 60 {
+		return n
+	}
+	return 120
+}
+
+// treeEntry is one numbered line of the tree.
+type treeEntry struct {
+	database  string
+	container *containerInfo
+}
+
+func (b *browser) tree() []treeEntry {
+	var entries []treeEntry
+	for _, db := range b.databases {
+		entries = append(entries, treeEntry{database: db})
+		if !b.open[db] {
+			continue
+		}
+		for i := range b.containers[db] {
+			entries = append(entries, treeEntry{database: db, container: &b.containers[db][i]})
+		}
+	}
+	return entries
+}
+
+func (b *browser) treeLines() []string {
+	var lines []string
+	for i, e := range b.tree() {
+		if e.container == nil {
+			sign := "+"
+			if b.open[e.database] {
+				sign = "-"
+			}
+			lines = append(lines, fmt.Sprintf("%3d %s %s", i+1, sign, e.database))
+			continue
+		}
+		marker := " "
+		if e.database == b.database && e.container.ID == b.container.ID {
+			marker = ">"
+		}
+		lines = append(lines, fmt.Sprintf("%3d %s   %s", i+1, marker, e.container.ID))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "(no databases)")
+	}
+	return lines
+}
+
+// itemLines returns the lines of the item pane and the index of the line
+// showing the first item of the page, -1 if there is none.
+func (b *browser) itemLines() ([]string, int) {
+	if b.container.ID == "" {
+		return []string{"Select a container in the tree"}, -1
+	}
+	pk, _ := json.Marshal(b.partitionKey)
+	lines := []string{fmt.Sprintf("%s\\%s  pk %v = %s", b.database, b.container.ID, b.container.PartitionKey, pk)}
+	if b.container.PartitionKey.hierarchical() {
+		return append(lines, "", "Hierarchical keys can't be browsed, use the partition command"), -1
+	}
+	if b.partitionKey == nil {
+		hint := "Enter k <value> to list a partition"
+		if b.keys {
+			hint = "Press k to list a partition"
+		}
+		return append(lines, "", hint), -1
+	}
+	if len(b.pages) == 0 {
+		return append(lines, "", "(not loaded)"), -1
+	}
+	page := b.pages[b.current]
+	nav := fmt.Sprintf("page %d, %v RU", b.current+1, page.RequestCharge)
+	if page.Continuation != "" {
+		nav += ", ] for more"
+	}
+	lines = append(lines, nav, "")
+	if len(page.Items) == 0 {
+		return append(lines, "(no items)"), -1
+	}
+	first := len(lines)
+	for i, item := range page.Items {
+		lines = append(lines, fmt.Sprintf("i%-3d %s", b.firstItemNumber()+i, summarizeItem(item)))
+	}
+	return lines, first
+}
+
+// firstItemNumber is the number of the first item of the current page,
+// counting across the pages loaded.
+func (b *browser) firstItemNumber() int {
+	n := 1
+	for _, p := range b.pages[:b.current] {
+		n += len(p.Items)
+	}
+	return n
+}
+
+// render redraws the whole screen.
+func (b *browser) render() {
+	width := terminalWidth()
+	left := 34
+	right := width - left - 3
+
+	title := "Cosmos DB browser   ? for help"
+	if b.keys {
+		title = "Cosmos DB browser   arrows, tab, enter; k partition, ? help, x back"
+	}
+	clearScreen()
+	fmt.Printf("%s\n", fit(title, width))
+	fmt.Printf("%s\n", strings.Repeat("-", width))
+
+	tree := b.treeLines()
+	items, firstItem := b.itemLines()
+	rows := len(tree)
+	if len(items) > rows {
+		rows = len(items)
+	}
+	for i := 0; i < rows; i++ {
+		l, r := "", ""
+		if i < len(tree) {
+			l = tree[i]
+		}
+		if i < len(items) {
+			r = items[i]
+		}
+		l, r = fmt.Sprintf("%-*s", left, fit(l, left)), fmt.Sprintf("%-*s", right, fit(r, right))
+		if b.keys && b.focus == treePane && i == b.treeRow {
+			l = highlight(l)
+		}
+		if b.keys && b.focus == itemPane && firstItem >= 0 && i == firstItem+b.itemRow {
+			r = highlight(r)
+		}
+		fmt.Printf("%s | %s\n", l, strings.TrimRight(r, " "))
+	}
+
+	fmt.Printf("%s\n", strings.Repeat("-", width))
+	fmt.Printf("%s\n", fit("Query: "+b.query, width))
+	fmt.Printf("%s\n", strings.Repeat("-", width))
+	if b.item != nil {
+		details, _ := json.MarshalIndent(b.item, "", "  ")
+		fmt.Printf("%s\n", details)
+		fmt.Printf("%s\n", strings.Repeat("-", width))
+	}
+	fmt.Printf("%s\n", fit(b.status.line, width))
+	if !b.keys {
+		fmt.Print("> ")
+	}
+}
+
+func fit(s string, width int) string {
+	return truncate(s, width)
+}
+
+// highlight shows s in reverse video, the cursor of the browser.
+func highlight(s string) string {
+	if !isTerminal() {
+		return s
+	}
+	return "\033[7m" + s + "\033[0m"
+}
+
+func (b *browser) loadDatabases(ctx context.Context) error {
+	databases, err := b.rc.listDatabases(ctx)
+	if err != nil {
+		return err
+	}
+	b.databases = nil
+	for _, db := range databases {
+		b.databases = append(b.databases, db.ID)
+	}
+	for db := range b.open {
+		if err := b.loadContainers(ctx, db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *browser) loadContainers(ctx context.Context, databaseName string) error {
+	containers, err := b.rc.listContainers(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	b.containers[databaseName] = containers
+	return nil
+}
+
+// loadItems runs the query against the selected partition from the first
+// page.
+func (b *browser) loadItems(ctx context.Context) error {
+	b.pages, b.current, b.item, b.itemRow = nil, 0, nil, 0
+	if b.container.ID == "" || b.partitionKey == nil || b.container.PartitionKey.hierarchical() {
+		return nil
+	}
+	pk, err := sdkPartitionKey(b.partitionKey)
+	if err != nil {
+		return err
+	}
+	page, err := queryItemsPageByKey(ctx, b.client, b.database, b.container.ID, b.query, pk, viewerPageSize, "")
+	if err != nil {
+		return err
+	}
+	b.pages = []queryPage{page}
+	return nil
+}
+
+func (b *browser) nextPage(ctx context.Context) error {
+	if len(b.pages) == 0 {
+		return nil
+	}
+	if b.current+1 < len(b.pages) {
+		b.current++
+		return nil
+	}
+	continuation := b.pages[b.current].Continuation
+	if continuation == "" {
+		return nil
+	}
+	pk, err := sdkPartitionKey(b.partitionKey)
+	if err != nil {
+		return err
+	}
+	page, err := queryItemsPageByKey(ctx, b.client, b.database, b.container.ID, b.query, pk, viewerPageSize, continuation)
+	if err != nil {
+		return err
+	}
+	b.pages = append(b.pages, page)
+	b.current++
+	return nil
+}
+
+// itemAt returns the n-th item listed, counting across the pages loaded.
+func (b *browser) itemAt(n int) (map[string]interface{}, bool) {
+	if n < 1 {
+		return nil, false
+	}
+	for _, page := range b.pages {
+		if n <= len(page.Items) {
+			return page.Items[n-1], true
+		}
+		n -= len(page.Items)
+	}
+	return nil, false
+}
+
+// partitionKeyOf returns the value of the selected container's partition key
+// in item, at a nested path or not. Hierarchical keys need the REST client,
+// which the browser doesn't use for items.
+func (b *browser) partitionKeyOf(item map[string]interface{}) (interface{}, error) {
+	if len(b.container.PartitionKey.Paths) != 1 {
+		return nil, fmt.Errorf("partition key %v can't be browsed, use the partition command", b.container.PartitionKey)
+	}
+	values, err := partitionKeyValues(item, b.container.PartitionKey.Paths)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// sdkPartitionKeyOf is partitionKeyOf as the SDK takes it.
+func (b *browser) sdkPartitionKeyOf(item map[string]interface{}) (azcosmos.PartitionKey, error) {
+	value, err := b.partitionKeyOf(item)
+	if err != nil {
+		return azcosmos.PartitionKey{}, err
+	}
+	return sdkPartitionKey(value)
+}
+
+func (b *browser) selectItem(ctx context.Context, item map[string]interface{}) error {
+	id, _ := item["id"].(string)
+	pk, err := b.sdkPartitionKeyOf(item)
+	if err != nil {
+		return err
+	}
+	b.item, err = pointReadByKey(ctx, b.client, b.database, b.container.ID, pk, id)
+	return err
+}
+
+func (b *browser) createItem(ctx context.Context, item map[string]interface{}) error {
+	pk, err := b.sdkPartitionKeyOf(item)
+	if err != nil {
+		return err
+	}
+	if _, ok := item["id"].(string); !ok {
+		return errors.New("item needs a string id")
+	}
+	body, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	container, err := b.client.NewContainer(b.database, b.container.ID)
+	if err != nil {
+		return err
+	}
+	res, err := container.CreateItem(ctx, pk, body, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Item [%v] created. Status %d. ActivityId %s. Consuming %v RU\n", item["id"], res.RawResponse.StatusCode, res.ActivityID, res.RequestCharge)
+	return b.loadItems(ctx)
+}
+
+// replaceItem replaces the selected item with item, which must keep its id
+// and partition key. It is replaced only if nobody changed it since it was
+// loaded.
+func (b *browser) replaceItem(ctx context.Context, item map[string]interface{}) error {
+	id, _ := b.item["id"].(string)
+	loadedETag, _ := b.item["_etag"].(string)
+	value, err := b.partitionKeyOf(b.item)
+	if err != nil {
+		return err
+	}
+	if newValue, err := b.partitionKeyOf(item); err != nil || newValue != value || item["id"] != id {
+		return errors.New("the id and partition key of an item can't be changed")
+	}
+	pk, err := sdkPartitionKey(value)
+	if err != nil {
+		return err
+	}
+	ok, err := b.guard.allowWrite(fmt.Sprintf("replace item [%v] in %v\\%v", id, b.database, b.container.ID))
+	if !ok {
+		return err
+	}
+
+	for _, name := range systemProperties {
+		delete(item, name)
+	}
+	body, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	container, err := b.client.NewContainer(b.database, b.container.ID)
+	if err != nil {
+		return err
+	}
+	etag := azcore.ETag(loadedETag)
+	res, err := container.ReplaceItem(ctx, pk, id, body, &azcosmos.ItemOptions{IfMatchEtag: &etag})
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("item [%v] changed since it was loaded, reload with r and edit it again: %w", id, err)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Item [%v] replaced. Status %d. ActivityId %s. Consuming %v RU\n", id, res.RawResponse.StatusCode, res.ActivityID, res.RequestCharge)
+	if err := b.loadItems(ctx); err != nil {
+		return err
+	}
+	return b.selectItem(ctx, item)
+}
+
+func (b *browser) deleteSelected(ctx context.Context) error {
+	id, _ := b.item["id"].(string)
+	pk, err := b.sdkPartitionKeyOf(b.item)
+	if err != nil {
+		return err
+	}
+	deleted, err := deleteItemByKey(ctx, b.client, b.guard, b.database, b.container.ID, pk, id)
+	if err != nil || deleted == nil {
+		return err
+	}
+	b.item = nil
+	return b.loadItems(ctx)
+}
+
+// parseJSONObject parses s as a JSON object.
+func parseJSONObject(s string) (map[string]interface{}, error) {
+	item := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &item); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	return item, nil
+}
+
+// handle runs one command. It reports done when the browser should close.
+func (b *browser) handle(ctx context.Context, input string) (done bool, err error) {
+	cmd, arg := input, ""
+	if i := strings.IndexByte(input, ' '); i >= 0 {
+		cmd, arg = input[:i], strings.TrimSpace(input[i+1:])
+	}
+
+	switch cmd {
+	case "":
+		return false, nil
+	case "r":
+		if err := b.loadDatabases(ctx); err != nil {
+			return false, err
+		}
+		return false, b.loadItems(ctx)
+	case "x":
+		return true, nil
+	case "?":
+		fmt.Printf("%s\n\nPress enter to return ", browseHelp)
+		_, err := readLine(ctx)
+		return false, err
+	case "k":
+		b.partitionKey = nil
+		if arg != "" {
+			b.partitionKey = partitionKeyInput(arg)
+		}
+		return false, b.loadItems(ctx)
+	case "q":
+		if arg == "" {
+			return false, errors.New("usage: q <sql>")
+		}
+		b.query = arg
+		return false, b.loadItems(ctx)
+	case "]":
+		return false, b.nextPage(ctx)
+	case "[":
+		if b.current > 0 {
+			b.current--
+		}
+		return false, nil
+	case "c":
+		item, err := parseJSONObject(arg)
+		if err != nil {
+			return false, err
+		}
+		return false, b.createItem(ctx, item)
+	}
+
+	if strings.HasPrefix(cmd, "i") {
+		n, err := strconv.Atoi(cmd[1:])
+		if err != nil {
+			return false, fmt.Errorf("unknown command %q, ? for help", input)
+		}
+		item, ok := b.itemAt(n)
+		if !ok {
+			return false, fmt.Errorf("no item %d", n)
+		}
+		return false, b.selectItem(ctx, item)
+	}
+	if n, err := strconv.Atoi(cmd); err == nil {
+		return false, b.openTreeEntry(ctx, n)
+	}
+
+	if b.item == nil && (cmd == "e" || cmd == "s" || cmd == "d") {
+		return false, errors.New("select an item first with i<n>")
+	}
+	switch cmd {
+	case "e":
+		item, err := parseJSONObject(arg)
+		if err != nil {
+			return false, err
+		}
+		return false, b.replaceItem(ctx, item)
+	case "s":
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return false, errors.New("usage: s field=value")
+		}
+		item := map[string]interface{}{}
+		for k, v := range b.item {
+			item[k] = v
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv[1]), &value); err != nil {
+			value = kv[1]
+		}
+		item[kv[0]] = value
+		return false, b.replaceItem(ctx, item)
+	case "d":
+		return false, b.deleteSelected(ctx)
+	}
+	return false, fmt.Errorf("unknown command %q, ? for help", input)
+}
+
+func (b *browser) openTreeEntry(ctx context.Context, n int) error {
+	entries := b.tree()
+	if n < 1 || n > len(entries) {
+		return fmt.Errorf("no tree entry %d", n)
+	}
+	e := entries[n-1]
+	if e.container == nil {
+		if b.open[e.database] {
+			delete(b.open, e.database)
+			return nil
+		}
+		b.open[e.database] = true
+		return b.loadContainers(ctx, e.database)
+	}
+	b.database, b.container, b.partitionKey = e.database, *e.container, nil
+	return b.loadItems(ctx)
+}
+
+// readKey waits for a key press and names it: up, down, left, right, pgup,
+// pgdn, home, end, enter, tab, ctrl-d, or the character typed. The terminal
+// is raw only while waiting, so prompts and confirmations read lines as
+// usual.
+func readKey(ctx context.Context) (string, error) {
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	r, err := readRune(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case '\t':
+		return "tab", nil
+	case 4:
+		return "ctrl-d", nil
+	case 27:
+		return readEscapeKey(ctx)
+	}
+	return string(r), nil
+}
+
+// readEscapeKey names the arrow, page and home/end keys, which the terminal
+// sends as escape sequences. Other sequences come back as "".
+func readEscapeKey(ctx context.Context) (string, error) {
+	b, err := readByte(ctx)
+	if err != nil || (b != '[' && b != 'O') {
+		return "", err
+	}
+	b, err = readByte(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case 'A':
+		return "up", nil
+	case 'B':
+		return "down", nil
+	case 'C':
+		return "right", nil
+	case 'D':
+		return "left", nil
+	case 'H':
+		return "home", nil
+	case 'F':
+		return "end", nil
+	case '1', '4', '5', '6', '7', '8':
+		// ESC [ n ~
+		if t, err := readByte(ctx); err != nil || t != '~' {
+			return "", err
+		}
+		switch b {
+		case '5':
+			return "pgup", nil
+		case '6':
+			return "pgdn", nil
+		case '1', '7':
+			return "home", nil
+		default:
+			return "end", nil
+		}
+	}
+	return "", nil
+}
+
+// ask prints prompt below the screen and reads the answer.
+func (b *browser) ask(ctx context.Context, prompt string) (string, error) {
+	fmt.Print(prompt)
+	return readLine(ctx)
+}
+
+// handleKey runs the command bound to key, turning it into the typed
+// command it stands for where there is one.
+func (b *browser) handleKey(ctx context.Context, key string) (done bool, err error) {
+	defer b.clampCursor()
+
+	switch key {
+	case "x", "ctrl-d":
+		return true, nil
+	case "up":
+		b.moveCursor(-1)
+	case "down":
+		b.moveCursor(1)
+	case "home":
+		b.moveCursor(-len(b.tree()) - viewerPageSize)
+	case "end":
+		b.moveCursor(len(b.tree()) + viewerPageSize)
+	case "tab":
+		if b.focus == treePane {
+			b.focus = itemPane
+		} else {
+			b.focus = treePane
+		}
+	case "left":
+		b.focus = treePane
+	case "right":
+		b.focus = itemPane
+	case "enter":
+		if b.focus == treePane {
+			entries := b.tree()
+			if b.treeRow >= len(entries) {
+				return false, nil
+			}
+			if entries[b.treeRow].container != nil {
+				b.focus = itemPane
+			}
+			return b.handle(ctx, strconv.Itoa(b.treeRow+1))
+		}
+		if len(b.pages) == 0 || b.itemRow >= len(b.pages[b.current].Items) {
+			return false, nil
+		}
+		return b.handle(ctx, fmt.Sprintf("i%d", b.firstItemNumber()+b.itemRow))
+	case "pgdn", "]":
+		b.itemRow = 0
+		return b.handle(ctx, "]")
+	case "pgup", "[":
+		b.itemRow = 0
+		return b.handle(ctx, "[")
+	case "d", "r":
+		return b.handle(ctx, key)
+	case "?":
+		fmt.Printf("%s\n\nPress any key to return ", browseKeysHelp)
+		_, err := readKey(ctx)
+		return false, err
+	case "k", "q", "c", "e", "s":
+		prompts := map[string]string{
+			"k": "Partition key value, JSON for a number or boolean: ",
+			"q": "Query: ",
+			"c": "New item JSON: ",
+			"e": "Replacement JSON for the selected item: ",
+			"s": "Set field=value on the selected item: ",
+		}
+		if (key == "e" || key == "s") && b.item == nil {
+			return false, errors.New("select an item first with enter")
+		}
+		answer, err := b.ask(ctx, prompts[key])
+		if err != nil || (answer == "" && key != "k") {
+			return false, err
+		}
+		if key == "k" {
+			b.focus = itemPane
+		}
+		return b.handle(ctx, key+" "+answer)
+	}
+	return false, nil
+}
+
+// moveCursor moves the cursor of the focused pane by n rows.
+func (b *browser) moveCursor(n int) {
+	if b.focus == treePane {
+		b.treeRow += n
+	} else {
+		b.itemRow += n
+	}
+}
+
+// clampCursor keeps the cursors on rows that exist, as the tree and the
+// page change under them.
+func (b *browser) clampCursor() {
+	clamp := func(row, rows int) int {
+		if row >= rows {
+			row = rows - 1
+		}
+		if row < 0 {
+			row = 0
+		}
+		return row
+	}
+	b.treeRow = clamp(b.treeRow, len(b.tree()))
+	rows := 0
+	if len(b.pages) > 0 {
+		rows = len(b.pages[b.current].Items)
+	}
+	b.itemRow = clamp(b.itemRow, rows)
+}
+
+// browse runs the browser until the user leaves it, reading single key
+// presses when stdin is a terminal and typed commands otherwise. Errors from
+// commands are shown on the status line rather than ending the session. Log
+// output is captured for the status line while the browser is open.
+func browse(ctx context.Context, client *azcosmos.Client, rc *restClient, guard *safety) error {
+	b := &browser{
+		client:     client,
+		rc:         rc,
+		guard:      guard,
+		containers: map[string][]containerInfo{},
+		open:       map[string]bool{},
+		query:      "SELECT * FROM c",
+		status:     &lastLine{},
+	}
+	if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+		restore()
+		b.keys = true
+	}
+
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(b.status)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	if err := b.loadDatabases(ctx); err != nil {
+		return err
+	}
+	for {
+		b.render()
+		var done bool
+		var err error
+		if b.keys {
+			key, readErr := readKey(ctx)
+			if readErr != nil {
+				return readErr
+			}
+			done, err = b.handleKey(ctx, key)
+		} else {
+			input, readErr := readLine(ctx)
+			if readErr != nil {
+				return readErr
+			}
+			done, err = b.handle(ctx, input)
+		}
+		if done {
+			return nil
+		}
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err != nil {
+			b.status.line = "Error: " + err.Error()
+		}
+	}
+}
+
+// runBrowseCommand implements `browse`.
+func runBrowseCommand(ctx context.Context, opts globalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: browse")
+	}
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	return browse(ctx, client, rc, newSafety(opts, p, rc))
+}
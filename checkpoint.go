@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// checkpointFile records how far long-running jobs got, so an interrupted
+// import can resume where it stopped instead of starting over.
+const checkpointFile = ".go-cosmos-checkpoint.json"
+
+// checkpoints maps a job key, such as "import:database-v2/customer@<digest>",
+// to the number of items already processed.
+type checkpoints map[string]int
+
+// importCheckpointKey names the checkpoint of importing items into a
+// container. It holds a digest of the items, so that only importing the
+// same items again resumes an interrupted import; another file or dataset
+// into the same container starts over.
+func importCheckpointKey(databaseName, containerName string, items []map[string]interface{}) (string, error) {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return "", err
+		}
+	}
+	return importCheckpointPrefix(databaseName, containerName) + hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+func importCheckpointPrefix(databaseName, containerName string) string {
+	return "import:" + databaseName + "/" + containerName + "@"
+}
+
+// discardOthers removes the checkpoints of other imports into the container
+// than key, reporting whether there were any.
+func (c checkpoints) discardOthers(databaseName, containerName, key string) bool {
+	prefix := importCheckpointPrefix(databaseName, containerName)
+	discarded := false
+	for k := range c {
+		// keys without a digest predate it and can't be matched either
+		if k != key && (strings.HasPrefix(k, prefix) || k == strings.TrimSuffix(prefix, "@")) {
+			delete(c, k)
+			discarded = true
+		}
+	}
+	return discarded
+}
+
+func loadCheckpoints() (checkpoints, error) {
+	b, err := os.ReadFile(checkpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoints{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := checkpoints{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c checkpoints) save() error {
+	if len(c) == 0 {
+		err := os.Remove(checkpointFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	b, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(checkpointFile, b, 0o644)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportCheckpointKey(t *testing.T) {
+	items := func() []map[string]interface{} {
+		return []map[string]interface{}{{"id": "1", "name": "a"}, {"id": "2", "name": "b"}}
+	}
+	key := func(databaseName, containerName string, items []map[string]interface{}) string {
+		k, err := importCheckpointKey(databaseName, containerName, items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	same := key("database-v4", "customer", items())
+	if again := key("database-v4", "customer", items()); again != same {
+		t.Errorf("the same items got keys %q and %q", same, again)
+	}
+	changed := items()
+	changed[1]["name"] = "c"
+	for name, other := range map[string]string{
+		"another container": key("database-v4", "product", items()),
+		"changed item":      key("database-v4", "customer", changed),
+		"fewer items":       key("database-v4", "customer", items()[:1]),
+		"reordered items":   key("database-v4", "customer", []map[string]interface{}{items()[1], items()[0]}),
+	} {
+		if other == same {
+			t.Errorf("%s: same key %q", name, same)
+		}
+	}
+}
+
+func TestCheckpointsDiscardOthers(t *testing.T) {
+	c := checkpoints{
+		"import:database-v4/customer@1111": 10,
+		"import:database-v4/customer@2222": 20,
+		"import:database-v4/customer":      30,
+		"import:database-v4/product@3333":  40,
+	}
+	if !c.discardOthers("database-v4", "customer", "import:database-v4/customer@2222") {
+		t.Error("discardOthers reported nothing discarded")
+	}
+	want := checkpoints{
+		"import:database-v4/customer@2222": 20,
+		"import:database-v4/product@3333":  40,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %v, want %v", c, want)
+	}
+	if c.discardOthers("database-v4", "customer", "import:database-v4/customer@2222") {
+		t.Error("discardOthers discarded the matching checkpoint")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// newClient builds a client for the profile, which should already have the
+// environment overrides applied. policies are added to the pipeline and run
+// on every attempt of every request.
+func newClient(p profile, policies ...policy.Policy) (*azcosmos.Client, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	options, err := p.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	options.PerRetryPolicies = append(options.PerRetryPolicies, policies...)
+
+	if len(p.PreferredRegions) > 0 {
+		// the SDK version we build against always talks to the account's
+		// default region, so the setting is accepted but has no effect yet
+		log.Printf("preferredRegions %v ignored: not supported by this SDK version\n", p.PreferredRegions)
+	}
+
+	switch p.authMode() {
+	case authKey:
+		cred, err := azcosmos.NewKeyCredential(p.Key)
+		if err != nil {
+			return nil, err
+		}
+		return azcosmos.NewClientWithKey(p.Endpoint, cred, options)
+
+	case authResourceToken:
+		cred, err := azcosmos.NewKeyCredential(resourceTokenPlaceholderKey)
+		if err != nil {
+			return nil, err
+		}
+		options.PerRetryPolicies = append(options.PerRetryPolicies, resourceTokenPolicy{token: p.ResourceToken})
+		return azcosmos.NewClientWithKey(p.Endpoint, cred, options)
+	}
+
+	cred, err := p.tokenCredential()
+	if err != nil {
+		return nil, err
+	}
+	return azcosmos.NewClient(p.Endpoint, cred, options)
+}
+
+// clientOptions combines the profile's settings, the environment overrides
+// and the TLS transport into the options shared by every client we build.
+func (p profile) clientOptions() (*azcosmos.ClientOptions, error) {
+	settings, err := p.settings(defaultSettings)
+	if err != nil {
+		return nil, err
+	}
+	settings, err = settings.applyEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	options := settings.clientOptions()
+
+	transport, err := p.transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		options.Transport = transport
+	}
+	return options, nil
+}
+
+// resourceTokenPlaceholderKey is a syntactically valid account key used to
+// build the client in resource token mode; its signatures are always
+// replaced by resourceTokenPolicy.
+const resourceTokenPlaceholderKey = "cmVzb3VyY2UtdG9rZW4="
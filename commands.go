@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// command is a non-interactive subcommand. Running without a subcommand
+// starts the interactive menu, where the same commands can be typed.
+type command struct {
+	name    string
+	summary string
+	// usage is shown by `help <name>`. Commands with flags print them after
+	// it.
+	usage string
+	flags bool
+	run   func(ctx context.Context, opts globalOptions, args []string) error
+}
+
+// schemaCommand runs `list`, `create` or `teardown`, which share
+// runSchemaCommand.
+func schemaCommand(name string) func(ctx context.Context, opts globalOptions, args []string) error {
+	return func(ctx context.Context, opts globalOptions, args []string) error {
+		return runSchemaCommand(ctx, opts, append([]string{name}, args...))
+	}
+}
+
+var commands = []command{
+	{name: "auth", summary: "report which credential is used and whether it can read the account", usage: "auth check", run: runAuthCommand},
+	{name: "export", summary: "export a database or containers to .ndjson files", usage: "export [-dir path] <database> [container...]", flags: true, run: runExportCommand},
+	{name: "list", summary: "list the databases and containers on the account", usage: "list", run: schemaCommand("list")},
+	{name: "create", summary: "create schema databases and containers, e.g. create 4 database-v2/customer", usage: "create [-shared] [-autoscale] [-throughput n] [-ttl duration] [-unique-key paths] [-subpartition paths] [version|database|database/container|pattern...]", flags: true, run: schemaCommand("create")},
+	{name: "throughput", summary: "show throughput for every database and container, or change it, e.g. throughput set -autoscale 4000 database-v4/customer", usage: "throughput show [database|database/container|pattern...] | throughput set (-manual n | -autoscale n) database[/container]", flags: true, run: runThroughputCommand},
+	{name: "ttl", summary: "show or change containers' time to live, set an item's ttl, or report what expires soon", usage: "ttl show [database|database/container|pattern...] | ttl [-database name] [-container name] set (duration|on|off) | item -pk value id (duration|never|off) | report [-days n]", flags: true, run: runTTLCommand},
+	{name: "import", summary: "import a JSON or .ndjson file or URL into a container, taking partition keys from the container's definition", usage: "import [-database name] [-container name] [-synthetic path=path,path...] [-ttl duration] url|file", flags: true, run: runImportCommand},
+	{name: "teardown", summary: "delete databases or containers, e.g. teardown database-v4/customer", usage: "teardown [version|database|database/container|pattern...]", run: schemaCommand("teardown")},
+	{name: "migrate", summary: "copy data into the next schema version, e.g. migrate -from 3 -to 4", usage: "migrate [-from n] [-to n]", flags: true, run: runMigrateCommand},
+	{name: "generate", summary: "generate a seeded sample dataset as .ndjson files, or -import it", usage: "generate [-version n] [-seed n] [-customers n] [-products n] [-categories n] [-tags n] [-max-orders n] [-order-ttl duration] [-out dir | -import]", flags: true, run: runGenerateCommand},
+	{name: "verify", summary: "check customers' salesOrderCount against their orders, -fix repairs it", usage: "verify [-fix] [-database name]", flags: true, run: runVerifyCommand},
+	{name: "integrity", summary: "check products against categories and order lines against products", usage: "integrity [-database name] [-report path] [-repair]", flags: true, run: runIntegrityCommand},
+	{name: "serve", summary: "serve customers, orders and categories over HTTP", usage: "serve [-addr host:port]", flags: true, run: runServeCommand},
+	{name: "browse", summary: "browse databases, containers and items full screen", usage: "browse", run: runBrowseCommand},
+	{name: "query", summary: `run a query against one partition a page at a time, e.g. query -pk <id> "SELECT * FROM c"`, usage: `query [-database name] [-container name] -pk value [-page-size n] [-continuation token] [-all] [-index-metrics] [-query-metrics] "SELECT ..."`, flags: true, run: runQueryCommand},
+	{name: "index", summary: "show a container's indexing policy, or apply one from a file, e.g. index exclude /details/*", usage: "index [-database name] [-container name] show [-out path] | apply -file path | exclude path...", flags: true, run: runIndexCommand},
+	{name: "script", summary: "manage stored procedures, triggers and user-defined functions, or execute a stored procedure", usage: "script [-database name] [-container name] [-kind sproc|trigger|udf] list | create [-id name] [-type pre|post] [-operation all|create|replace|delete|upsert] file.js | replace [-id name] file.js | delete id | exec -pk value [-log] id [param...]", flags: true, run: runScriptCommand},
+	{name: "partition", summary: "show a container's partition key, point read an item or list a partition, hierarchical keys included", usage: "partition [-database name] [-container name] show | read -pk value [-pk value...] id | items -pk value [-pk value...]", flags: true, run: runPartitionCommand},
+	{name: "bench", summary: "drive a mix of reads, queries, order creates and deletes and report latency and RU", usage: "bench [-database name] [-container name] [-mix ops] [-concurrency n] [-rate n] [-duration d] [-ops n] [-customers n] [-seed n] [-out path]", flags: true, run: runBenchCommand},
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printCommands(out io.Writer) {
+	fmt.Fprintf(out, "\nCommands:\n")
+	w := tabwriter.NewWriter(out, 0, 0, 4, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	w.Flush()
+}
+
+// printCommandHelp shows the usage of one command, and its flags.
+func printCommandHelp(ctx context.Context, opts globalOptions, name string) error {
+	c, ok := lookupCommand(name)
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	fmt.Printf("%s\n\nUsage: %s\n", c.summary, c.usage)
+	if c.flags {
+		fmt.Println()
+		// -h makes the command's flag set print its defaults and stop
+		if err := c.run(ctx, opts, []string{"-h"}); err != flag.ErrHelp {
+			return err
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: go-cosmos [flags] [command]\n\nFlags:\n")
+	flag.PrintDefaults()
+	printCommands(out)
+}
+
+// runCommand dispatches a subcommand such as `auth check`.
+func runCommand(ctx context.Context, opts globalOptions, args []string) error {
+	if args[0] == "help" {
+		if len(args) > 1 {
+			return printCommandHelp(ctx, opts, args[1])
+		}
+		usage()
+		return nil
+	}
+	c, ok := lookupCommand(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command %q, run with -h for a list of commands", args[0])
+	}
+	return c.run(ctx, opts, args[1:])
+}
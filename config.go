@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// config is the on-disk configuration, by default
+// ~/.config/go-cosmos/config.json:
+//
+//	{
+//	    "defaultProfile": "dev",
+//	    "profiles": {
+//	        "dev": {
+//	            "endpoint": "https://cosmos-dev.documents.azure.com:443/",
+//	            "auth": "default",
+//	            "defaultDatabase": "database-v4",
+//	            "defaultContainer": "customer",
+//	            "consistencyLevel": "Session"
+//	        }
+//	    }
+//	}
+type config struct {
+	DefaultProfile string             `json:"defaultProfile,omitempty"`
+	Profiles       map[string]profile `json:"profiles"`
+}
+
+// globalOptions are the command line flags that select and adjust the
+// connection profile.
+type globalOptions struct {
+	ConfigPath         string
+	Profile            string
+	Auth               string
+	Emulator           bool
+	CACertFile         string
+	InsecureSkipVerify bool
+	DryRun             bool
+	Backup             bool
+	BackupDir          string
+	QueryMetrics       bool
+}
+
+// resolveProfile loads the selected profile and layers the environment and
+// then the command line flags on top of it.
+func (o globalOptions) resolveProfile() (profile, error) {
+	cfg, err := loadConfig(o.ConfigPath)
+	if err != nil {
+		return profile{}, err
+	}
+	p, err := cfg.profile(o.Profile)
+	if err != nil {
+		return profile{}, err
+	}
+	p = p.applyEnvironment()
+
+	if o.Emulator {
+		p = p.useEmulator()
+	}
+	if o.Auth != "" {
+		p.Auth = o.Auth
+	}
+	if o.CACertFile != "" {
+		p.CACertFile = o.CACertFile
+	}
+	if o.InsecureSkipVerify {
+		p.InsecureSkipVerify = true
+	}
+	return p.resolveConnection()
+}
+
+// profile describes one account the CLI can connect to.
+type profile struct {
+	Name                      string   `json:"-"`
+	Endpoint                  string   `json:"endpoint,omitempty"`
+	ConnectionString          string   `json:"connectionString,omitempty"`
+	Emulator                  bool     `json:"emulator,omitempty"`
+	CACertFile                string   `json:"caCertFile,omitempty"`
+	InsecureSkipVerify        bool     `json:"insecureSkipVerify,omitempty"`
+	Auth                      string   `json:"auth,omitempty"`
+	Key                       string   `json:"key,omitempty"`
+	ResourceToken             string   `json:"resourceToken,omitempty"`
+	TenantID                  string   `json:"tenantId,omitempty"`
+	ClientID                  string   `json:"clientId,omitempty"`
+	ClientSecret              string   `json:"clientSecret,omitempty"`
+	ClientCertificate         string   `json:"clientCertificate,omitempty"`
+	ClientCertificatePassword string   `json:"clientCertificatePassword,omitempty"`
+	FederatedTokenFile        string   `json:"federatedTokenFile,omitempty"`
+	DefaultDatabase           string   `json:"defaultDatabase,omitempty"`
+	DefaultContainer          string   `json:"defaultContainer,omitempty"`
+	PreferredRegions          []string `json:"preferredRegions,omitempty"`
+	ConsistencyLevel          string   `json:"consistencyLevel,omitempty"`
+	OperationTimeout          string   `json:"operationTimeout,omitempty"`
+	Protected                 bool     `json:"protected,omitempty"`
+	// Throughput is what new databases and containers are provisioned
+	// with, defaultProvisioning if unset.
+	Throughput *provisioning `json:"throughput,omitempty"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-cosmos", "config.json")
+}
+
+// loadConfig reads the config file at path. A missing file is not an error,
+// so the CLI keeps working from environment variables alone.
+func loadConfig(path string) (config, error) {
+	c := config{Profiles: map[string]profile{}}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]profile{}
+	}
+	return c, nil
+}
+
+// profile returns the named profile, or the default profile when name is
+// empty. With no name and no default an empty profile is returned, leaving
+// everything to the environment.
+func (c config) profile(name string) (profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return profile{}, nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return profile{}, fmt.Errorf("profile %q not found, available profiles: %v", name, names)
+	}
+	p.Name = name
+	return p, nil
+}
+
+// applyEnvironment overrides profile values with AZURE_COSMOS_* environment
+// variables, which always take precedence over the config file.
+func (p profile) applyEnvironment() profile {
+	if v := os.Getenv("AZURE_COSMOS_CONNECTION_STRING"); v != "" {
+		p.ConnectionString = v
+		p.Emulator = false
+		p.Endpoint = ""
+		p.Key = ""
+		p.Auth = ""
+	}
+	if v := os.Getenv("AZURE_COSMOS_ENDPOINT"); v != "" {
+		p.Endpoint = v
+	}
+	if v := os.Getenv("AZURE_COSMOS_KEY"); v != "" {
+		p.Key = v
+		p.Auth = authKey
+	}
+	if v := os.Getenv("AZURE_COSMOS_DATABASE"); v != "" {
+		p.DefaultDatabase = v
+	}
+	if v := os.Getenv("AZURE_COSMOS_CONTAINER"); v != "" {
+		p.DefaultContainer = v
+	}
+	if v := os.Getenv("AZURE_COSMOS_CONSISTENCY_LEVEL"); v != "" {
+		p.ConsistencyLevel = v
+	}
+	return p.applyAuthEnvironment()
+}
+
+func (p profile) validate() error {
+	if p.Endpoint == "" {
+		return errors.New("no endpoint configured: set AZURE_COSMOS_ENDPOINT or AZURE_COSMOS_CONNECTION_STRING, use --emulator, or select a profile with --profile")
+	}
+
+	if err := p.validateAuth(); err != nil {
+		return err
+	}
+
+	if p.ConsistencyLevel != "" {
+		if _, err := p.consistencyLevel(); err != nil {
+			return err
+		}
+	}
+
+	if p.Throughput != nil {
+		if err := p.Throughput.validate(); err != nil {
+			return fmt.Errorf("profile %q throughput: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p profile) consistencyLevel() (azcosmos.ConsistencyLevel, error) {
+	for _, level := range azcosmos.ConsistencyLevelValues() {
+		if string(level) == p.ConsistencyLevel {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("unknown consistency level %q, expected one of %v", p.ConsistencyLevel, azcosmos.ConsistencyLevelValues())
+}
+
+// settings returns s with any overrides from the profile applied.
+func (p profile) settings(s settings) (settings, error) {
+	if p.OperationTimeout != "" {
+		d, err := time.ParseDuration(p.OperationTimeout)
+		if err != nil {
+			return s, fmt.Errorf("profile %q operationTimeout: %w", p.Name, err)
+		}
+		s.OperationTimeout = d
+	}
+	if p.ConsistencyLevel != "" {
+		level, err := p.consistencyLevel()
+		if err != nil {
+			return s, err
+		}
+		s.ConsistencyLevel = level
+	}
+	return s, nil
+}
+
+func (p profile) provisioning() provisioning {
+	if p.Throughput != nil {
+		return *p.Throughput
+	}
+	return defaultProvisioning
+}
+
+func (p profile) database(fallback string) string {
+	if p.DefaultDatabase != "" {
+		return p.DefaultDatabase
+	}
+	return fallback
+}
+
+func (p profile) container(fallback string) string {
+	if p.DefaultContainer != "" {
+		return p.DefaultContainer
+	}
+	return fallback
+}
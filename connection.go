@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// The local emulator always listens on the same endpoint with the same,
+// publicly documented key.
+const (
+	emulatorEndpoint = "https://localhost:8081/"
+	emulatorKey      = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
+)
+
+// parseConnectionString extracts the endpoint and key from a Cosmos DB
+// connection string of the form "AccountEndpoint=...;AccountKey=...;".
+// Keys are matched case-insensitively and unknown keys are ignored.
+func parseConnectionString(connectionString string) (endpoint, key string, err error) {
+	for _, part := range strings.Split(connectionString, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		// account keys are base64 and may end in '=', so only split once
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", "", fmt.Errorf("connection string: malformed segment %q", part)
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "accountendpoint":
+			endpoint = strings.TrimSpace(kv[1])
+		case "accountkey":
+			key = strings.TrimSpace(kv[1])
+		}
+	}
+
+	if endpoint == "" {
+		return "", "", errors.New("connection string: AccountEndpoint is missing")
+	}
+	if key == "" {
+		return "", "", errors.New("connection string: AccountKey is missing")
+	}
+	return endpoint, key, nil
+}
+
+// useEmulator points the profile at the local emulator, replacing any
+// endpoint or credentials it had.
+func (p profile) useEmulator() profile {
+	p.Emulator = true
+	p.ConnectionString = ""
+	p.Endpoint = emulatorEndpoint
+	p.Key = emulatorKey
+	p.Auth = authKey
+	return p
+}
+
+// resolveConnection fills in the endpoint and key from emulator mode or a
+// connection string. Values that are already set are left alone so the
+// environment keeps precedence over the config file.
+func (p profile) resolveConnection() (profile, error) {
+	if p.Emulator {
+		if p.Endpoint == "" {
+			p.Endpoint = emulatorEndpoint
+		}
+		if p.Key == "" && p.Auth == "" {
+			p.Key = emulatorKey
+			p.Auth = authKey
+		}
+	}
+
+	if p.ConnectionString != "" {
+		endpoint, key, err := parseConnectionString(p.ConnectionString)
+		if err != nil {
+			return p, err
+		}
+		if p.Endpoint == "" {
+			p.Endpoint = endpoint
+		}
+		if p.Key == "" && (p.Auth == "" || p.Auth == authKey) {
+			p.Key = key
+			p.Auth = authKey
+		}
+	}
+	return p, nil
+}
+
+// transport returns an HTTP transport honouring the profile's TLS settings,
+// or nil to use the SDK default.
+func (p profile) transport() (policy.Transporter, error) {
+	// the emulator uses a self-signed certificate; unless we were given its
+	// CA, skip verification (which is only ever allowed for localhost)
+	insecure := p.InsecureSkipVerify || (p.Emulator && p.CACertFile == "")
+	if p.CACertFile == "" && !insecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if p.CACertFile != "" {
+		pem, err := os.ReadFile(p.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", p.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if insecure {
+		local, err := isLocalEndpoint(p.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if !local {
+			return nil, fmt.Errorf("refusing to skip TLS verification for non-local endpoint %s", p.Endpoint)
+		}
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+func isLocalEndpoint(endpoint string) (bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true, nil
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback(), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           string
+		wantEndpoint string
+		wantKey      string
+		wantErr      string
+	}{
+		{
+			name:         "account",
+			in:           "AccountEndpoint=https://acct.documents.azure.com:443/;AccountKey=abc==;",
+			wantEndpoint: "https://acct.documents.azure.com:443/",
+			wantKey:      "abc==",
+		},
+		{
+			name:         "keys are case-insensitive, spaces and unknown keys ignored",
+			in:           " accountkey = abc= ; ACCOUNTENDPOINT=https://acct/ ; Database=x",
+			wantEndpoint: "https://acct/",
+			wantKey:      "abc=",
+		},
+		{
+			name:         "emulator",
+			in:           "AccountEndpoint=" + emulatorEndpoint + ";AccountKey=" + emulatorKey,
+			wantEndpoint: emulatorEndpoint,
+			wantKey:      emulatorKey,
+		},
+		{name: "missing endpoint", in: "AccountKey=abc", wantErr: "AccountEndpoint is missing"},
+		{name: "missing key", in: "AccountEndpoint=https://acct/", wantErr: "AccountKey is missing"},
+		{name: "empty", in: "", wantErr: "AccountEndpoint is missing"},
+		{name: "malformed segment", in: "AccountEndpoint=https://acct/;AccountKey", wantErr: "malformed segment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, key, err := parseConnectionString(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if endpoint != tt.wantEndpoint || key != tt.wantKey {
+				t.Errorf("got %q, %q, want %q, %q", endpoint, key, tt.wantEndpoint, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestResolveConnection(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           profile
+		wantEndpoint string
+		wantKey      string
+		wantAuth     string
+	}{
+		{
+			name:         "emulator",
+			in:           profile{Emulator: true},
+			wantEndpoint: emulatorEndpoint,
+			wantKey:      emulatorKey,
+			wantAuth:     authKey,
+		},
+		{
+			name:         "emulator keeps an explicit endpoint and auth",
+			in:           profile{Emulator: true, Endpoint: "https://127.0.0.1:8081/", Auth: authDefault},
+			wantEndpoint: "https://127.0.0.1:8081/",
+			wantAuth:     authDefault,
+		},
+		{
+			name:         "connection string",
+			in:           profile{ConnectionString: "AccountEndpoint=https://acct/;AccountKey=abc"},
+			wantEndpoint: "https://acct/",
+			wantKey:      "abc",
+			wantAuth:     authKey,
+		},
+		{
+			name:         "environment endpoint wins over the connection string",
+			in:           profile{Endpoint: "https://env/", ConnectionString: "AccountEndpoint=https://acct/;AccountKey=abc"},
+			wantEndpoint: "https://env/",
+			wantKey:      "abc",
+			wantAuth:     authKey,
+		},
+		{
+			name:         "another auth mode ignores the key",
+			in:           profile{Auth: authDefault, ConnectionString: "AccountEndpoint=https://acct/;AccountKey=abc"},
+			wantEndpoint: "https://acct/",
+			wantAuth:     authDefault,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.in.resolveConnection()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Endpoint != tt.wantEndpoint || p.Key != tt.wantKey || p.Auth != tt.wantAuth {
+				t.Errorf("got endpoint %q key %q auth %q, want %q %q %q", p.Endpoint, p.Key, p.Auth, tt.wantEndpoint, tt.wantKey, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestTransportInsecureOnlyForLocalhost(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           profile
+		wantInsecure bool
+		wantErr      bool
+	}{
+		{name: "default", in: profile{Endpoint: "https://acct.documents.azure.com/"}},
+		{name: "emulator", in: profile{Emulator: true, Endpoint: emulatorEndpoint}, wantInsecure: true},
+		{name: "loopback ip", in: profile{InsecureSkipVerify: true, Endpoint: "https://127.0.0.1:8081/"}, wantInsecure: true},
+		{name: "ipv6 loopback", in: profile{InsecureSkipVerify: true, Endpoint: "https://[::1]:8081/"}, wantInsecure: true},
+		{name: "remote", in: profile{InsecureSkipVerify: true, Endpoint: "https://acct.documents.azure.com/"}, wantErr: true},
+		{name: "emulator pointed elsewhere", in: profile{Emulator: true, Endpoint: "https://10.0.0.5:8081/"}, wantErr: true},
+		{name: "localhost prefix is not localhost", in: profile{InsecureSkipVerify: true, Endpoint: "https://localhost.example.com/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := tt.in.transport()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			insecure := false
+			if transport != nil {
+				insecure = transport.(*http.Client).Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify
+			}
+			if insecure != tt.wantInsecure {
+				t.Errorf("InsecureSkipVerify = %v, want %v", insecure, tt.wantInsecure)
+			}
+		})
+	}
+}
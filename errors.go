@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// errorKind is a coarse classification of the errors returned by the SDK,
+// so callers can branch on "already exists" or "throttled" without
+// inspecting status codes themselves.
+type errorKind int
+
+const (
+	errKindUnknown errorKind = iota
+	errKindThrottled
+	errKindConflict
+	errKindNotFound
+	errKindPreconditionFailed
+	errKindTimeout
+	errKindAuth
+)
+
+func (k errorKind) String() string {
+	switch k {
+	case errKindThrottled:
+		return "throttled"
+	case errKindConflict:
+		return "conflict"
+	case errKindNotFound:
+		return "not found"
+	case errKindPreconditionFailed:
+		return "precondition failed"
+	case errKindTimeout:
+		return "timeout"
+	case errKindAuth:
+		return "auth"
+	default:
+		return "unknown"
+	}
+}
+
+// classifyError maps err onto an errorKind. It is safe to call with errors
+// that did not come from an HTTP response (nil, transport or context errors).
+func classifyError(err error) errorKind {
+	if err == nil {
+		return errKindUnknown
+	}
+
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return classifyStatus(responseErr.StatusCode)
+	}
+	var batchErr *batchFailedError
+	if errors.As(err, &batchErr) {
+		return classifyStatus(int(batchErr.StatusCode))
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errKindTimeout
+	}
+	return errKindUnknown
+}
+
+func classifyStatus(status int) errorKind {
+	switch status {
+	case http.StatusTooManyRequests:
+		return errKindThrottled
+	case http.StatusConflict:
+		return errKindConflict
+	case http.StatusNotFound:
+		return errKindNotFound
+	case http.StatusPreconditionFailed:
+		return errKindPreconditionFailed
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return errKindTimeout
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errKindAuth
+	}
+	return errKindUnknown
+}
+
+// batchFailedError is returned when the service refused a transactional
+// batch. The batch itself succeeds at the HTTP level; StatusCode is that of
+// the operation that failed, e.g. 409 for creating an item that exists.
+type batchFailedError struct {
+	Operation  int
+	StatusCode int32
+}
+
+func (e *batchFailedError) Error() string {
+	return fmt.Sprintf("transactional batch failed: operation %d returned status %d", e.Operation, e.StatusCode)
+}
+
+// failedBatchError finds the operation that made a batch fail; the others
+// answer 424 Failed Dependency.
+func failedBatchError(results []azcosmos.TransactionalBatchResult) error {
+	for index, operation := range results {
+		if operation.StatusCode != http.StatusFailedDependency {
+			return &batchFailedError{Operation: index, StatusCode: operation.StatusCode}
+		}
+	}
+	return errors.New("ExecuteTransactionalBatch failed")
+}
+
+func isConflict(err error) bool {
+	return classifyError(err) == errKindConflict
+}
+
+func isNotFound(err error) bool {
+	return classifyError(err) == errKindNotFound
+}
+
+func isPreconditionFailed(err error) bool {
+	return classifyError(err) == errKindPreconditionFailed
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// exportContainer writes every item in the container to dir/<container>.ndjson,
+// one JSON document per line, and returns the number of items written. The
+// file is written under a temporary name and only renamed once complete, so
+// an interrupted export never leaves a truncated file that looks finished.
+func exportContainer(ctx context.Context, rc *restClient, databaseName, containerName, dir string) (n int, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(dir, containerName+".ndjson")
+	tmp := path + ".partial"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp, path)
+		} else {
+			os.Remove(tmp)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	err = rc.readItems(ctx, databaseName, containerName, func(item json.RawMessage) error {
+		if _, err := w.Write(item); err != nil {
+			return err
+		}
+		n++
+		return w.WriteByte('\n')
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+// exportDatabase exports every container in the database into dir.
+func exportDatabase(ctx context.Context, rc *restClient, databaseName, dir string) error {
+	containers, err := rc.listContainers(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		start := time.Now()
+		n, err := exportContainer(ctx, rc, databaseName, container.ID, dir)
+		if err != nil {
+			return fmt.Errorf("export %v\\%v: %w", databaseName, container.ID, err)
+		}
+		log.Printf("Exported %d items from %v\\%v to %v in %f seconds\n", n, databaseName, container.ID, dir, time.Since(start).Seconds())
+	}
+	return nil
+}
+
+// backupDir returns a fresh timestamped directory under base for a backup of
+// databaseName.
+func backupDir(base, databaseName string) string {
+	return filepath.Join(base, databaseName+"-"+time.Now().UTC().Format("20060102T150405Z"))
+}
+
+// runExportCommand implements `export [-dir path] <database> [container...]`.
+func runExportCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory to write the .ndjson files to (default <backup-dir>/<database>-<timestamp>)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New("usage: export [-dir path] <database> [container...]")
+	}
+	databaseName := fs.Arg(0)
+	if *dir == "" {
+		*dir = backupDir(opts.BackupDir, databaseName)
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 1 {
+		return exportDatabase(ctx, rc, databaseName, *dir)
+	}
+	for _, containerName := range fs.Args()[1:] {
+		n, err := exportContainer(ctx, rc, databaseName, containerName, *dir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d items from %v\\%v to %v\n", n, databaseName, containerName, *dir)
+	}
+	return nil
+}
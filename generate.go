@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// generator builds a synthetic dataset from a seed. The same seed and scale
+// always produce the same data, ids included.
+type generator struct {
+	rng *rand.Rand
+	// base is the earliest customer creation date; everything else is an
+	// offset from it, so output doesn't depend on when it was generated.
+	base time.Time
+}
+
+// generateScale sets how much data to generate.
+type generateScale struct {
+	Categories int
+	Tags       int
+	Products   int
+	Customers  int
+	MaxOrders  int // per customer
+}
+
+var (
+	genFirstNames = []string{"Ana", "Ben", "Chloe", "Daniel", "Elena", "Farah", "George", "Hana", "Ivan", "Julia", "Kenji", "Laura", "Mateo", "Nia", "Omar", "Priya", "Quinn", "Rosa", "Samuel", "Tara", "Uma", "Victor", "Wei", "Yara", "Zane"}
+	genLastNames  = []string{"Anderson", "Brown", "Chen", "Diaz", "Evans", "Fischer", "Garcia", "Hughes", "Ito", "Johnson", "Kowalski", "Lopez", "Martin", "Nguyen", "Okafor", "Patel", "Rossi", "Smith", "Tanaka", "Walker"}
+	genTitles     = []string{"", "", "Mr.", "Ms.", "Mrs.", "Dr."}
+	genCities     = []struct{ city, state, country string }{
+		{"Seattle", "WA", "US"}, {"Portland", "OR", "US"}, {"Denver", "CO", "US"}, {"Austin", "TX", "US"},
+		{"Toronto", "ON", "CA"}, {"Vancouver", "BC", "CA"}, {"London", "England", "GB"}, {"Manchester", "England", "GB"},
+		{"Berlin", "BE", "DE"}, {"Paris", "IDF", "FR"}, {"Sydney", "NSW", "AU"}, {"Melbourne", "VIC", "AU"},
+	}
+	genStreets    = []string{"Main St", "Oak Ave", "Pine Rd", "Maple Dr", "Cedar Ln", "Lake Blvd", "Hill St", "River Rd"}
+	genCategories = []string{
+		"Bikes, Road Bikes", "Bikes, Mountain Bikes", "Bikes, Touring Bikes", "Components, Handlebars",
+		"Components, Wheels", "Components, Brakes", "Components, Chains", "Clothing, Jerseys", "Clothing, Gloves",
+		"Clothing, Shorts", "Accessories, Helmets", "Accessories, Tires and Tubes", "Accessories, Bottles and Cages",
+		"Accessories, Lights", "Accessories, Locks", "Accessories, Pumps",
+	}
+	genTags     = []string{"Tag-1", "Tag-2", "Tag-3", "Tag-4", "Tag-5", "Tag-6", "Tag-7", "Tag-8", "Tag-9", "Tag-10", "Tag-11", "Tag-12", "Tag-13", "Tag-14", "Tag-15", "Tag-16", "Tag-17", "Tag-18", "Tag-19", "Tag-20"}
+	genModels   = []string{"Sport", "Touring", "Road", "Mountain", "Classic", "Pro", "Trail", "City"}
+	genColors   = []string{"Black", "Blue", "Red", "Silver", "Yellow", "White"}
+	genSizes    = []string{"S", "M", "L", "XL", "42", "44", "48", "52"}
+	genProducts = []string{"Frame", "Wheel", "Helmet", "Jersey", "Glove", "Tire", "Tube", "Bottle", "Light", "Lock", "Pump", "Chain", "Brake", "Handlebar"}
+)
+
+func newGenerator(seed int64) *generator {
+	return &generator{
+		rng:  rand.New(rand.NewSource(seed)),
+		base: time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (g *generator) id() string {
+	id, err := uuid.NewRandomFromReader(g.rng)
+	if err != nil {
+		// rand.Rand.Read never fails
+		panic(err)
+	}
+	return strings.ToUpper(id.String())
+}
+
+func (g *generator) pick(options []string) string {
+	return options[g.rng.Intn(len(options))]
+}
+
+func (g *generator) date(maxDays int) time.Time {
+	return g.base.AddDate(0, 0, g.rng.Intn(maxDays))
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05")
+}
+
+func (g *generator) hex(n int) string {
+	b := make([]byte, n)
+	g.rng.Read(b)
+	return fmt.Sprintf("%X", b)
+}
+
+// world is one generated dataset, shaped for a schema version by
+// shapeDataset.
+type world struct {
+	categories []map[string]interface{}
+	tags       []map[string]interface{}
+	products   []map[string]interface{}
+	customers  []map[string]interface{}
+	orders     []map[string]interface{}
+}
+
+func (g *generator) world(scale generateScale) (*world, error) {
+	if scale.Categories < 1 || scale.Categories > len(genCategories) {
+		return nil, fmt.Errorf("categories must be between 1 and %d", len(genCategories))
+	}
+	if scale.Tags < 0 || scale.Tags > len(genTags) {
+		return nil, fmt.Errorf("tags must be between 0 and %d", len(genTags))
+	}
+	if scale.Products < 1 || scale.Customers < 0 || scale.MaxOrders < 0 {
+		return nil, errors.New("need at least one product, and no negative counts")
+	}
+
+	w := &world{}
+	for _, name := range genCategories[:scale.Categories] {
+		w.categories = append(w.categories, map[string]interface{}{"id": g.id(), "name": name})
+	}
+	for _, name := range genTags[:scale.Tags] {
+		w.tags = append(w.tags, map[string]interface{}{"id": g.id(), "name": name})
+	}
+
+	for i := 0; i < scale.Products; i++ {
+		category := w.categories[g.rng.Intn(len(w.categories))]
+		noun := g.pick(genProducts)
+		color := g.pick(genColors)
+		size := g.pick(genSizes)
+		name := fmt.Sprintf("%s-%d %s %s, %s", g.pick(genModels), 100+g.rng.Intn(900), noun, color, size)
+		var tags []interface{}
+		for _, j := range g.rng.Perm(len(w.tags))[:g.rng.Intn(minInt(len(w.tags), 3)+1)] {
+			tags = append(tags, map[string]interface{}{"id": w.tags[j]["id"], "name": w.tags[j]["name"]})
+		}
+		if tags == nil {
+			tags = []interface{}{}
+		}
+		w.products = append(w.products, map[string]interface{}{
+			"id":           g.id(),
+			"categoryId":   category["id"],
+			"categoryName": category["name"],
+			// the index keeps SKUs unique however the random parts fall
+			"sku":         fmt.Sprintf("%s-%s%d-%s", strings.ToUpper(noun[:2]), color[:1], i, size),
+			"name":        name,
+			"description": fmt.Sprintf("The product called \"%s\"", name),
+			"price":       math.Round((5+g.rng.Float64()*1500)*100) / 100,
+			"tags":        tags,
+		})
+	}
+
+	for i := 0; i < scale.Customers; i++ {
+		first, last := g.pick(genFirstNames), g.pick(genLastNames)
+		created := g.date(365)
+		var addresses []interface{}
+		for j := 0; j < 1+g.rng.Intn(2); j++ {
+			place := genCities[g.rng.Intn(len(genCities))]
+			addresses = append(addresses, map[string]interface{}{
+				"addressLine1": fmt.Sprintf("%d %s", 1+g.rng.Intn(9999), g.pick(genStreets)),
+				"addressLine2": "",
+				"city":         place.city,
+				"state":        place.state,
+				"country":      place.country,
+				"zipCode":      fmt.Sprintf("%05d", g.rng.Intn(100000)),
+			})
+		}
+		customer := map[string]interface{}{
+			"id":           g.id(),
+			"title":        g.pick(genTitles),
+			"firstName":    first,
+			"lastName":     last,
+			"emailAddress": fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), i),
+			"phoneNumber":  fmt.Sprintf("%d-555-%04d", 100+g.rng.Intn(900), g.rng.Intn(10000)),
+			"creationDate": formatDate(created),
+			"addresses":    addresses,
+			"password":     map[string]interface{}{"hash": g.hex(32), "salt": g.hex(4)},
+		}
+		w.customers = append(w.customers, customer)
+
+		orders := g.rng.Intn(scale.MaxOrders + 1)
+		customer["salesOrderCount"] = orders
+		for j := 0; j < orders; j++ {
+			ordered := created.AddDate(0, 0, 1+g.rng.Intn(700))
+			var details []interface{}
+			for k := 0; k < 1+g.rng.Intn(4); k++ {
+				product := w.products[g.rng.Intn(len(w.products))]
+				details = append(details, map[string]interface{}{
+					"sku":      product["sku"],
+					"name":     product["name"],
+					"price":    product["price"],
+					"quantity": 1 + g.rng.Intn(3),
+				})
+			}
+			w.orders = append(w.orders, map[string]interface{}{
+				"id":         g.id(),
+				"customerId": customer["id"],
+				"orderDate":  formatDate(ordered),
+				"shipDate":   formatDate(ordered.AddDate(0, 0, 7)),
+				"details":    details,
+			})
+		}
+	}
+	return w, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// generatedContainer is the data for one container of a schema version.
+type generatedContainer struct {
+	Container string
+	PK        string // partition key member, without the leading "/"
+	Items     []map[string]interface{}
+}
+
+// withMembers returns a copy of item with the given members set, or removed when
+// the value is nil.
+func withMembers(item map[string]interface{}, members ...interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(item)+len(members)/2)
+	for k, v := range item {
+		out[k] = v
+	}
+	for i := 0; i+1 < len(members); i += 2 {
+		k := members[i].(string)
+		if members[i+1] == nil {
+			delete(out, k)
+		} else {
+			out[k] = members[i+1]
+		}
+	}
+	return out
+}
+
+func mapItems(items []map[string]interface{}, fn func(map[string]interface{}) map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		out = append(out, fn(item))
+	}
+	return out
+}
+
+// shapeDataset lays the world out in the containers of a schema version,
+// using the same containers and partition keys as migrate.
+func shapeDataset(w *world, version int) ([]generatedContainer, error) {
+	category := func(c map[string]interface{}) map[string]interface{} { return withMembers(c, "type", "category") }
+	tag := func(t map[string]interface{}) map[string]interface{} { return withMembers(t, "type", "tag") }
+	plainCustomer := func(c map[string]interface{}) map[string]interface{} { return withMembers(c, "salesOrderCount", nil) }
+
+	switch version {
+	case 2:
+		return []generatedContainer{
+			{Container: "customer", PK: "id", Items: mapItems(w.customers, plainCustomer)},
+			{Container: "salesOrder", PK: "customerId", Items: w.orders},
+			{Container: "product", PK: "id", Items: mapItems(w.products, func(p map[string]interface{}) map[string]interface{} { return withMembers(p, "categoryName", nil) })},
+			{Container: "productCategory", PK: "type", Items: mapItems(w.categories, category)},
+			{Container: "productTag", PK: "type", Items: mapItems(w.tags, tag)},
+		}, nil
+	case 3:
+		return []generatedContainer{
+			{Container: "customer", PK: "id", Items: mapItems(w.customers, plainCustomer)},
+			{Container: "salesOrder", PK: "customerId", Items: mapItems(w.orders, func(o map[string]interface{}) map[string]interface{} { return withMembers(o, "type", "salesOrder") })},
+			{Container: "product", PK: "categoryId", Items: w.products},
+			{Container: "productCategory", PK: "type", Items: mapItems(w.categories, category)},
+			{Container: "productTag", PK: "type", Items: mapItems(w.tags, tag)},
+		}, nil
+	case 4:
+		customers := mapItems(w.customers, func(c map[string]interface{}) map[string]interface{} {
+			return withMembers(c, "type", "customer", "customerId", c["id"])
+		})
+		orders := mapItems(w.orders, func(o map[string]interface{}) map[string]interface{} { return withMembers(o, "type", "salesOrder") })
+		return []generatedContainer{
+			{Container: "customer", PK: "customerId", Items: append(customers, orders...)},
+			{Container: "product", PK: "categoryId", Items: w.products},
+			{Container: "productMeta", PK: "type", Items: append(mapItems(w.categories, category), mapItems(w.tags, tag)...)},
+		}, nil
+	}
+	return nil, fmt.Errorf("can't generate schema v%d, only v2 to v4", version)
+}
+
+// writeNDJSON writes items to path, one JSON document per line, in the same
+// format as export.
+func writeNDJSON(path string, items []map[string]interface{}) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// runGenerateCommand implements `generate [-version n] [-seed n] [scale flags] [-out dir | -import]`.
+func runGenerateCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	version := fs.Int("version", 4, "schema version to shape the data for, 2 to 4")
+	seed := fs.Int64("seed", 1, "random seed; the same seed and scale give the same data")
+	var scale generateScale
+	fs.IntVar(&scale.Customers, "customers", 100, "number of customers")
+	fs.IntVar(&scale.Products, "products", 200, "number of products")
+	fs.IntVar(&scale.Categories, "categories", 10, fmt.Sprintf("number of product categories, up to %d", len(genCategories)))
+	fs.IntVar(&scale.Tags, "tags", 20, fmt.Sprintf("number of product tags, up to %d", len(genTags)))
+	fs.IntVar(&scale.MaxOrders, "max-orders", 5, "most sales orders per customer")
+	out := fs.String("out", "generated", "directory to write <database>/<container>.ndjson files to")
+	importData := fs.Bool("import", false, "import into the account instead of writing files")
+	orderTTL := ttlFlag(fs, "order-ttl", "give sales orders a ttl, such as 90d, so they expire that long after they are written")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: generate [-version n] [-seed n] [-customers n] [-products n] [-categories n] [-tags n] [-max-orders n] [-order-ttl duration] [-out dir | -import]")
+	}
+
+	w, err := newGenerator(*seed).world(scale)
+	if err != nil {
+		return err
+	}
+	// item ttl only counts in containers with time to live on, so new
+	// containers get it turned on, with nothing else expiring; existing
+	// ones are left as they are, with a warning
+	var policy containerPolicy
+	if ttl := orderTTL(); ttl != nil {
+		withTTL(w.orders, *ttl)
+		on := int32(-1)
+		policy.DefaultTTL = &on
+	}
+	containers, err := shapeDataset(w, *version)
+	if err != nil {
+		return err
+	}
+	databaseName := schemaDatabaseName(*version)
+
+	if !*importData {
+		for _, c := range containers {
+			path := filepath.Join(*out, databaseName, c.Container+".ndjson")
+			if err := writeNDJSON(path, c.Items); err != nil {
+				return err
+			}
+			log.Printf("Wrote %d items to %v\n", len(c.Items), path)
+		}
+		return nil
+	}
+
+	if opts.DryRun {
+		for _, c := range containers {
+			log.Printf("[dry-run] would import %d generated items into %v\\%v\n", len(c.Items), databaseName, c.Container)
+		}
+		return nil
+	}
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	if err := newSafety(opts, p, rc).checkProtected(fmt.Sprintf("import generated data into %s", databaseName)); err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	if err := CreateDatabaseAndContainers(ctx, client, databaseName, *version, p.provisioning()); err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := createContainer(ctx, client, databaseName, c.Container, "/"+c.PK, p.provisioning(), policy); err != nil {
+			return err
+		}
+		if policy.DefaultTTL != nil && hasTTL(c.Items) {
+			if err := warnIfTTLOff(ctx, rc, databaseName, c.Container); err != nil {
+				return err
+			}
+		}
+		log.Printf("Importing %d generated items into %v\\%v\n", len(c.Items), databaseName, c.Container)
+		if err := importItems(ctx, client, rc, c.Items, databaseName, c.Container, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// readImportItems reads the items to import from source: an http(s) URL or
+// a file, holding either a JSON array, like the sample data, or one JSON
+// document per line, like export and generate write.
+func readImportItems(ctx context.Context, source string) ([]map[string]interface{}, error) {
+	var b []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", source, res.Status)
+		}
+		if b, err = io.ReadAll(res.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if b, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	items := []map[string]interface{}{}
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("[")) {
+		if err := json.Unmarshal(b, &items); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", source, err)
+		}
+		return items, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		item := map[string]interface{}{}
+		if err := dec.Decode(&item); err != nil {
+			return nil, fmt.Errorf("reading %s, item %d: %w", source, len(items)+1, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// runImportCommand implements `import [-database name] [-container name]
+// [-synthetic path=paths...] url|file`. The partition key paths come from
+// the container, so nested, numeric, boolean and hierarchical keys need no
+// flags; -synthetic builds key members the data doesn't have.
+func runImportCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: import [-database name] [-container name] [-synthetic path=path,path...] [-ttl duration] url|file"
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database of the container")
+	containerName := fs.String("container", p.container("customer"), "container to import into")
+	synthetic := syntheticKeyFlag(fs, "synthetic", "set a member from others joined by "+syntheticKeySeparator+", e.g. /partitionKey=/customerId,/type; repeatable")
+	ttl := ttlFlag(fs, "ttl", "give the items a ttl, such as 90d, so they expire that long after they are written, or never")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(usage)
+	}
+	source := fs.Arg(0)
+
+	items, err := readImportItems(ctx, source)
+	if err != nil {
+		return err
+	}
+	if ttl() != nil {
+		withTTL(items, *ttl())
+	}
+	if opts.DryRun {
+		log.Printf("[dry-run] would import %d items from %v into %v\\%v\n", len(items), source, *databaseName, *containerName)
+		return nil
+	}
+
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	if err := newSafety(opts, p, rc).checkProtected(fmt.Sprintf("import %s into %s\\%s", source, *databaseName, *containerName)); err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	if t := ttl(); t != nil && *t > 0 {
+		if err := warnIfTTLOff(ctx, rc, *databaseName, *containerName); err != nil {
+			return err
+		}
+	}
+	log.Printf("Importing %d items from %v into %v\\%v\n", len(items), source, *databaseName, *containerName)
+	return importItems(ctx, client, rc, items, *databaseName, *containerName, synthetic())
+}
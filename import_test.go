@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadImportItems(t *testing.T) {
+	want := []map[string]interface{}{
+		{"id": "1", "customerId": "c1", "year": float64(2024)},
+		{"id": "2", "address": map[string]interface{}{"country": "US"}},
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "json array",
+			content: `[{"id": "1", "customerId": "c1", "year": 2024}, {"id": "2", "address": {"country": "US"}}]`,
+			want:    want,
+		},
+		{
+			name:    "json array after whitespace",
+			content: "\n  [{\"id\": \"1\", \"customerId\": \"c1\", \"year\": 2024},\n {\"id\": \"2\", \"address\": {\"country\": \"US\"}}]\n",
+			want:    want,
+		},
+		{
+			name:    "ndjson",
+			content: "{\"id\": \"1\", \"customerId\": \"c1\", \"year\": 2024}\n{\"id\": \"2\", \"address\": {\"country\": \"US\"}}\n",
+			want:    want,
+		},
+		{
+			name:    "ndjson with blank lines and no final newline",
+			content: "{\"id\": \"1\", \"customerId\": \"c1\", \"year\": 2024}\n\n{\"id\": \"2\", \"address\": {\"country\": \"US\"}}",
+			want:    want,
+		},
+		{name: "empty", content: "", want: []map[string]interface{}{}},
+		{name: "empty array", content: "[]", want: []map[string]interface{}{}},
+		{name: "array of non-objects", content: `[1, 2]`, wantErr: "reading"},
+		{name: "bad line", content: "{\"id\": \"1\"}\n{\"id\": \n", wantErr: "item 2"},
+		{name: "a line that isn't an object", content: "{\"id\": \"1\"}\n\"2\"\n", wantErr: "item 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "items.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readImportItems(context.Background(), path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadImportItemsURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/customer" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"id": "1"}, {"id": "2"}]`))
+	}))
+	defer srv.Close()
+
+	got, err := readImportItems(context.Background(), srv.URL+"/customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]interface{}{{"id": "1"}, {"id": "2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := readImportItems(context.Background(), srv.URL+"/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want a 404", err)
+	}
+}
+
+func TestReadImportItemsMissingFile(t *testing.T) {
+	if _, err := readImportItems(context.Background(), filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// indexMetrics is the index utilization the service reports for a query
+// run with PopulateIndexMetrics: which indexes it used, and which it would
+// have used had they existed.
+type indexMetrics struct {
+	UtilizedSingleIndexes     []singleIndexMetric    `json:"UtilizedSingleIndexes"`
+	PotentialSingleIndexes    []singleIndexMetric    `json:"PotentialSingleIndexes"`
+	UtilizedCompositeIndexes  []compositeIndexMetric `json:"UtilizedCompositeIndexes"`
+	PotentialCompositeIndexes []compositeIndexMetric `json:"PotentialCompositeIndexes"`
+}
+
+type singleIndexMetric struct {
+	FilterExpression string `json:"FilterExpression"`
+	IndexSpec        string `json:"IndexSpec"`
+	IndexImpactScore string `json:"IndexImpactScore"`
+}
+
+type compositeIndexMetric struct {
+	IndexSpecs       []string `json:"IndexSpecs"`
+	IndexImpactScore string   `json:"IndexImpactScore"`
+}
+
+// decodeIndexMetrics decodes the x-ms-cosmos-index-utilization header, which
+// is base64 encoded JSON.
+func decodeIndexMetrics(header string) (indexMetrics, error) {
+	var m indexMetrics
+	b, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		// some service versions send the JSON as is
+		b = []byte(header)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("decoding index metrics: %w", err)
+	}
+	return m, nil
+}
+
+// recommendations turns the potential indexes into the indexing policy
+// entries that would add them.
+func (m indexMetrics) recommendations() azcosmos.IndexingPolicy {
+	var policy azcosmos.IndexingPolicy
+	for _, s := range m.PotentialSingleIndexes {
+		policy.IncludedPaths = append(policy.IncludedPaths, azcosmos.IncludedPath{Path: s.IndexSpec})
+	}
+	for _, c := range m.PotentialCompositeIndexes {
+		var composite []azcosmos.CompositeIndex
+		for _, spec := range c.IndexSpecs {
+			// specs look like "/lastName ASC"
+			fields := strings.Fields(spec)
+			if len(fields) == 0 {
+				continue
+			}
+			order := azcosmos.CompositeIndexAscending
+			if len(fields) > 1 && strings.EqualFold(fields[1], "DESC") {
+				order = azcosmos.CompositeIndexDescending
+			}
+			composite = append(composite, azcosmos.CompositeIndex{Path: fields[0], Order: order})
+		}
+		policy.CompositeIndexes = append(policy.CompositeIndexes, composite)
+	}
+	return policy
+}
+
+func printIndexMetrics(w io.Writer, m indexMetrics) {
+	fmt.Fprintf(w, "Index utilization:\n")
+	if len(m.UtilizedSingleIndexes)+len(m.UtilizedCompositeIndexes) == 0 {
+		fmt.Fprintf(w, "  no indexes used\n")
+	}
+	for _, s := range m.UtilizedSingleIndexes {
+		fmt.Fprintf(w, "  used      %-30s %s\n", s.IndexSpec, s.FilterExpression)
+	}
+	for _, c := range m.UtilizedCompositeIndexes {
+		fmt.Fprintf(w, "  used      (%s)\n", strings.Join(c.IndexSpecs, ", "))
+	}
+	for _, s := range m.PotentialSingleIndexes {
+		fmt.Fprintf(w, "  missing   %-30s %s, impact %s\n", s.IndexSpec, s.FilterExpression, s.IndexImpactScore)
+	}
+	for _, c := range m.PotentialCompositeIndexes {
+		fmt.Fprintf(w, "  missing   (%s), impact %s\n", strings.Join(c.IndexSpecs, ", "), c.IndexImpactScore)
+	}
+
+	recommended := m.recommendations()
+	if len(recommended.IncludedPaths)+len(recommended.CompositeIndexes) == 0 {
+		return
+	}
+	b, err := json.MarshalIndent(struct {
+		IncludedPaths    []azcosmos.IncludedPath     `json:"includedPaths,omitempty"`
+		CompositeIndexes [][]azcosmos.CompositeIndex `json:"compositeIndexes,omitempty"`
+	}{recommended.IncludedPaths, recommended.CompositeIndexes}, "  ", "    ")
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "Recommended additions to the indexing policy (see `index`):\n  %s\n", b)
+}
+
+// readContainerProperties returns a client for the container and its
+// properties, including the indexing policy.
+func readContainerProperties(ctx context.Context, client *azcosmos.Client, databaseName, containerName string) (*azcosmos.ContainerClient, azcosmos.ContainerProperties, error) {
+	container, err := client.NewContainer(databaseName, containerName)
+	if err != nil {
+		return nil, azcosmos.ContainerProperties{}, err
+	}
+	resp, err := container.Read(ctx, nil)
+	if err != nil {
+		return nil, azcosmos.ContainerProperties{}, err
+	}
+	if resp.ContainerProperties == nil {
+		return nil, azcosmos.ContainerProperties{}, fmt.Errorf("no properties returned for %v\\%v", databaseName, containerName)
+	}
+	return container, *resp.ContainerProperties, nil
+}
+
+// indexTransformationProgress returns how far, in percent, the container is
+// through re-indexing after a policy change.
+func (c *restClient) indexTransformationProgress(ctx context.Context, databaseName, containerName string) (string, error) {
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	headers := map[string]string{"x-ms-documentdb-populatequotainfo": "true"}
+	resp, err := c.do(ctx, http.MethodGet, "/"+link, restResource{resourceType: "colls", resourceLink: link}, headers, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("x-ms-documentdb-collection-index-transformation-progress"), nil
+}
+
+// loadIndexingPolicy reads a policy from a JSON file, refusing members the
+// SDK doesn't know so a typo can't silently drop part of the policy.
+func loadIndexingPolicy(path string) (azcosmos.IndexingPolicy, error) {
+	var policy azcosmos.IndexingPolicy
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return policy, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// applyIndexingPolicy replaces the container's indexing policy. The service
+// re-indexes in the background; queries keep working meanwhile, using the
+// indexes that are complete.
+func applyIndexingPolicy(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName string, policy azcosmos.IndexingPolicy) error {
+	container, properties, err := readContainerProperties(ctx, client, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	current, err := json.MarshalIndent(properties.IndexingPolicy, "", "    ")
+	if err != nil {
+		return err
+	}
+	updated, err := json.MarshalIndent(policy, "", "    ")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, updated) {
+		log.Printf("Indexing policy of %v\\%v is already up to date\n", databaseName, containerName)
+		return nil
+	}
+	fmt.Printf("Current indexing policy:\n%s\nNew indexing policy:\n%s\n", current, updated)
+
+	ok, err := guard.allowWrite(fmt.Sprintf("replace the indexing policy of %v\\%v", databaseName, containerName))
+	if !ok {
+		return err
+	}
+	properties.IndexingPolicy = &policy
+	resp, err := container.Replace(ctx, properties, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Indexing policy of %v\\%v replaced. ActivityId %s. Consuming %v RU\n", databaseName, containerName, resp.ActivityID, resp.RequestCharge)
+	log.Printf("The container re-indexes in the background; `index show` reports progress\n")
+	return nil
+}
+
+// runIndexCommand implements `index show`, `index apply -file path` and
+// `index exclude path...` for one container.
+func runIndexCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: index [-database name] [-container name] show [-out path] | apply -file path | exclude path..."
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database of the container")
+	containerName := fs.String("container", p.container("customer"), "container whose indexing policy to show or change")
+	out := fs.String("out", "", "show: also write the policy to this file, to edit and apply")
+	file := fs.String("file", "", "apply: JSON file with the indexing policy to apply")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// flags may also follow the subcommand, as in `index apply -file p.json`
+	sub := fs.Args()
+	if len(sub) == 0 {
+		return errors.New(usage)
+	}
+	if err := fs.Parse(sub[1:]); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	switch sub[0] {
+	case "show":
+		if len(rest) > 0 {
+			return errors.New(usage)
+		}
+		_, properties, err := readContainerProperties(ctx, client, *databaseName, *containerName)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(properties.IndexingPolicy, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+		if *out != "" {
+			if err := os.WriteFile(*out, append(b, '\n'), 0o644); err != nil {
+				return err
+			}
+			log.Printf("Indexing policy written to %v\n", *out)
+		}
+
+		rc, err := newRESTClient(p)
+		if err != nil {
+			return err
+		}
+		progress, err := rc.indexTransformationProgress(ctx, *databaseName, *containerName)
+		if err != nil {
+			return err
+		}
+		if progress != "" && progress != "100" {
+			fmt.Printf("Re-indexing after the last policy change: %s%% done\n", progress)
+		}
+		return nil
+
+	case "apply":
+		if *file == "" || len(rest) > 0 {
+			return errors.New(usage)
+		}
+		policy, err := loadIndexingPolicy(*file)
+		if err != nil {
+			return err
+		}
+		rc, err := newRESTClient(p)
+		if err != nil {
+			return err
+		}
+		return applyIndexingPolicy(ctx, client, newSafety(opts, p, rc), *databaseName, *containerName, policy)
+
+	case "exclude":
+		if len(rest) == 0 {
+			return errors.New(usage)
+		}
+		_, properties, err := readContainerProperties(ctx, client, *databaseName, *containerName)
+		if err != nil {
+			return err
+		}
+		policy := azcosmos.IndexingPolicy{Automatic: true, IndexingMode: azcosmos.IndexingModeConsistent}
+		if properties.IndexingPolicy != nil {
+			policy = *properties.IndexingPolicy
+		}
+	paths:
+		for _, path := range rest {
+			for _, excluded := range policy.ExcludedPaths {
+				if excluded.Path == path {
+					continue paths
+				}
+			}
+			policy.ExcludedPaths = append(policy.ExcludedPaths, azcosmos.ExcludedPath{Path: path})
+		}
+		rc, err := newRESTClient(p)
+		if err != nil {
+			return err
+		}
+		return applyIndexingPolicy(ctx, client, newSafety(opts, p, rc), *databaseName, *containerName, policy)
+	}
+	return errors.New(usage)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	stdinOnce   sync.Once
+	stdinChunks chan []byte
+	// stdinPending holds bytes read from stdin but not yet consumed. It is
+	// only touched by the goroutine reading input.
+	stdinPending []byte
+)
+
+// readByte returns the next byte from stdin, returning early with ctx.Err() if
+// the context is cancelled while waiting (for example on Ctrl-C). Stdin is
+// read by a single background goroutine so an abandoned read doesn't swallow
+// the next input, and so line reads and the line editor share one stream.
+func readByte(ctx context.Context) (byte, error) {
+	stdinOnce.Do(func() {
+		stdinChunks = make(chan []byte)
+		go func() {
+			buf := make([]byte, 256)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					chunk := make([]byte, n)
+					copy(chunk, buf[:n])
+					stdinChunks <- chunk
+				}
+				if err != nil {
+					close(stdinChunks)
+					return
+				}
+			}
+		}()
+	})
+
+	for len(stdinPending) == 0 {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case chunk, ok := <-stdinChunks:
+			if !ok {
+				return 0, io.EOF
+			}
+			stdinPending = chunk
+		}
+	}
+	b := stdinPending[0]
+	stdinPending = stdinPending[1:]
+	return b, nil
+}
+
+// readLine reads one line from stdin, returning early with ctx.Err() if the
+// context is cancelled while waiting.
+func readLine(ctx context.Context) (string, error) {
+	var line []byte
+	for {
+		b, err := readByte(ctx)
+		if err == io.EOF && len(line) > 0 {
+			return strings.TrimSpace(string(line)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSpace(string(line)), nil
+		}
+		line = append(line, b)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// integrityProblem is one finding of the integrity scan.
+type integrityProblem struct {
+	Kind       string `json:"kind"`
+	Container  string `json:"container"`
+	ID         string `json:"id"`
+	CategoryID string `json:"categoryId,omitempty"`
+	Expected   string `json:"expected,omitempty"`
+	Found      string `json:"found,omitempty"`
+	SKU        string `json:"sku,omitempty"`
+	Repaired   bool   `json:"repaired,omitempty"`
+	// Skipped is set when the product changed between the scan and the
+	// repair, so it was left alone.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+const (
+	problemMissingCategory = "missingCategory"
+	problemCategoryName    = "categoryNameMismatch"
+	problemMissingProduct  = "missingProduct"
+)
+
+// integrityReport is what the scan writes to its report file.
+type integrityReport struct {
+	Database   string             `json:"database"`
+	Categories int                `json:"categories"`
+	Products   int                `json:"products"`
+	Orders     int                `json:"orders"`
+	Problems   []integrityProblem `json:"problems"`
+}
+
+// categoryContainerFor returns where a schema database keeps its categories:
+// productMeta from v4 on, productCategory before.
+func categoryContainerFor(databaseName string) string {
+	if databaseName == schemaDatabaseName(4) {
+		return "productMeta"
+	}
+	return "productCategory"
+}
+
+// checkIntegrity cross-checks the denormalized copies in a schema database:
+// each product's categoryId and categoryName against the categories, and each
+// sales order line's sku against the products. With repair, stale
+// categoryName values are rewritten from the category; missing categories and
+// products can't be repaired and are only reported.
+func checkIntegrity(ctx context.Context, client *azcosmos.Client, rc *restClient, guard *safety, databaseName string, repair bool) (*integrityReport, error) {
+	report := &integrityReport{Database: databaseName, Problems: []integrityProblem{}}
+	categoryContainer := categoryContainerFor(databaseName)
+
+	categories := map[string]string{}
+	err := rc.readItems(ctx, databaseName, categoryContainer, func(raw json.RawMessage) error {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		if t, ok := item["type"]; ok && t != "category" {
+			return nil
+		}
+		id, _ := item["id"].(string)
+		categories[id], _ = categoryValue(item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read %v\\%v: %w", databaseName, categoryContainer, err)
+	}
+	report.Categories = len(categories)
+
+	products, err := client.NewContainer(databaseName, "product")
+	if err != nil {
+		return nil, err
+	}
+	skus := map[string]bool{}
+	err = rc.readItems(ctx, databaseName, "product", func(raw json.RawMessage) error {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		report.Products++
+		id, _ := item["id"].(string)
+		if sku, ok := item["sku"].(string); ok {
+			skus[sku] = true
+		}
+
+		categoryID, _ := item["categoryId"].(string)
+		name, ok := categories[categoryID]
+		if !ok {
+			report.Problems = append(report.Problems, integrityProblem{Kind: problemMissingCategory, Container: "product", ID: id, CategoryID: categoryID})
+			return nil
+		}
+		found, _ := item["categoryName"].(string)
+		if found == name {
+			return nil
+		}
+
+		problem := integrityProblem{Kind: problemCategoryName, Container: "product", ID: id, CategoryID: categoryID, Expected: name, Found: found}
+		if repair {
+			repaired, err := repairCategoryName(ctx, products, guard, databaseName, item, name)
+			if isPreconditionFailed(err) {
+				log.Printf("Product [%v] changed since the scan, skipping it; run integrity again\n", id)
+				problem.Skipped = true
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+			problem.Repaired = repaired
+		}
+		report.Problems = append(report.Problems, problem)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read %v\\product: %w", databaseName, err)
+	}
+
+	// orders live in their own container before v4 and next to their
+	// customer from v4 on
+	orderContainer := "customer"
+	if databaseName != schemaDatabaseName(4) {
+		orderContainer = "salesOrder"
+	}
+	err = rc.readItems(ctx, databaseName, orderContainer, func(raw json.RawMessage) error {
+		order := struct {
+			ID      string `json:"id"`
+			Type    string `json:"type"`
+			Details []struct {
+				SKU string `json:"sku"`
+			} `json:"details"`
+		}{}
+		if err := json.Unmarshal(raw, &order); err != nil {
+			return err
+		}
+		if orderContainer == "customer" && order.Type != "salesOrder" {
+			return nil
+		}
+		report.Orders++
+		for _, line := range order.Details {
+			if !skus[line.SKU] {
+				report.Problems = append(report.Problems, integrityProblem{Kind: problemMissingProduct, Container: orderContainer, ID: order.ID, SKU: line.SKU})
+			}
+		}
+		return nil
+	})
+	if isNotFound(err) {
+		log.Printf("No %v\\%v, skipping order lines\n", databaseName, orderContainer)
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %v\\%v: %w", databaseName, orderContainer, err)
+	}
+
+	sort.SliceStable(report.Problems, func(i, j int) bool { return report.Problems[i].Kind < report.Problems[j].Kind })
+	return report, nil
+}
+
+// repairCategoryName rewrites a product's categoryName. The product is
+// replaced only if it still has the ETag seen during the scan, so changes made
+// to it since then aren't lost to the scan's copy.
+func repairCategoryName(ctx context.Context, container *azcosmos.ContainerClient, guard *safety, databaseName string, product map[string]interface{}, name string) (bool, error) {
+	id, _ := product["id"].(string)
+	categoryID, _ := product["categoryId"].(string)
+	scanned, _ := product["_etag"].(string)
+	etag := azcore.ETag(scanned)
+	ok, err := guard.allowWrite(fmt.Sprintf("replace product [%v] categoryName %q with %q in %v\\product", id, product["categoryName"], name, databaseName))
+	if !ok {
+		return false, err
+	}
+
+	for _, p := range systemProperties {
+		delete(product, p)
+	}
+	product["categoryName"] = name
+	b, err := json.Marshal(product)
+	if err != nil {
+		return false, err
+	}
+	if _, err := container.ReplaceItem(ctx, azcosmos.NewPartitionKeyString(categoryID), id, b, &azcosmos.ItemOptions{IfMatchEtag: &etag}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func writeIntegrityReport(path string, report *integrityReport) error {
+	b, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// runIntegrityCommand implements `integrity [-database name] [-report path] [-repair]`.
+func runIntegrityCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("integrity", flag.ContinueOnError)
+	databaseName := fs.String("database", "database-v4", "schema database to check, database-v3 or database-v4")
+	reportPath := fs.String("report", "integrity-report.json", "file to write the report to")
+	repair := fs.Bool("repair", false, "rewrite stale categoryName values from their category")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: integrity [-database name] [-report path] [-repair]")
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	report, err := checkIntegrity(ctx, client, rc, newSafety(opts, p, rc), *databaseName, *repair)
+	if err != nil {
+		return err
+	}
+	if err := writeIntegrityReport(*reportPath, report); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	repaired, skipped := 0, 0
+	for _, problem := range report.Problems {
+		counts[problem.Kind]++
+		if problem.Repaired {
+			repaired++
+		}
+		if problem.Skipped {
+			skipped++
+		}
+	}
+	fmt.Printf("Checked %d categories, %d products and %d orders in %v\n", report.Categories, report.Products, report.Orders, report.Database)
+	fmt.Printf("  products with no category:       %d\n", counts[problemMissingCategory])
+	fmt.Printf("  products with stale categoryName: %d\n", counts[problemCategoryName])
+	fmt.Printf("  order lines with unknown sku:     %d\n", counts[problemMissingProduct])
+	if *repair {
+		fmt.Printf("  repaired:                         %d\n", repaired)
+		fmt.Printf("  skipped, changed since the scan:  %d\n", skipped)
+	}
+	fmt.Printf("Report written to %v\n", *reportPath)
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHistory is how many lines the history file keeps.
+const maxHistory = 500
+
+// lineEditor reads lines with readline-style editing: cursor movement, Ctrl-A
+// and Ctrl-E, Ctrl-K, Ctrl-U and Ctrl-W kills, up and down for history and
+// tab for completion. If stdin isn't a terminal it reads plain lines.
+type lineEditor struct {
+	history     []string
+	historyPath string
+	// complete returns the candidates for the word being typed, given the
+	// words before it.
+	complete func(ctx context.Context, before []string, word string) []string
+}
+
+func defaultHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-cosmos", "history")
+}
+
+// newLineEditor loads the history file at path. A missing file starts an
+// empty history; an empty path keeps history for this session only.
+func newLineEditor(path string, complete func(ctx context.Context, before []string, word string) []string) *lineEditor {
+	e := &lineEditor{historyPath: path, complete: complete}
+	if path == "" {
+		return e
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return e
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	return e
+}
+
+// addHistory records line, skipping repeats of the previous line, and
+// rewrites the history file.
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	if e.historyPath == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyPath), 0o700); err != nil {
+		return
+	}
+	_ = os.WriteFile(e.historyPath, []byte(strings.Join(e.history, "\n")+"\n"), 0o600)
+}
+
+// readLine shows prompt and reads a line. It returns io.EOF on Ctrl-D at an
+// empty line.
+func (e *lineEditor) readLine(ctx context.Context, prompt string) (string, error) {
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Print(prompt)
+		line, err := readLine(ctx)
+		if err == nil {
+			e.addHistory(line)
+		}
+		return line, err
+	}
+	defer restore()
+
+	s := &editState{prompt: prompt, historyIndex: len(e.history)}
+	s.refresh()
+	for {
+		r, err := readRune(ctx)
+		if err != nil {
+			fmt.Print("\r\n")
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Print("\r\n")
+			line := strings.TrimSpace(string(s.buf))
+			e.addHistory(line)
+			return line, nil
+		case 4: // Ctrl-D
+			if len(s.buf) == 0 {
+				fmt.Print("\r\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case 127, 8: // backspace
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case 1: // Ctrl-A
+			s.pos = 0
+		case 5: // Ctrl-E
+			s.pos = len(s.buf)
+		case 2: // Ctrl-B
+			if s.pos > 0 {
+				s.pos--
+			}
+		case 6: // Ctrl-F
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case 11: // Ctrl-K
+			s.buf = s.buf[:s.pos]
+		case 21: // Ctrl-U
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		case 23: // Ctrl-W
+			start := s.pos
+			for start > 0 && s.buf[start-1] == ' ' {
+				start--
+			}
+			start = wordStartAt(s.buf, start)
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case 12: // Ctrl-L
+			clearScreen()
+		case 16: // Ctrl-P
+			e.recall(s, -1)
+		case 14: // Ctrl-N
+			e.recall(s, 1)
+		case '\t':
+			e.completeWord(ctx, s)
+		case 27: // escape sequence
+			if err := e.escape(ctx, s); err != nil {
+				return "", err
+			}
+		default:
+			if r >= 32 {
+				s.insert(r)
+			}
+		}
+		s.refresh()
+	}
+}
+
+// escape handles the arrow, home, end and delete keys.
+func (e *lineEditor) escape(ctx context.Context, s *editState) error {
+	b, err := readByte(ctx)
+	if err != nil || (b != '[' && b != 'O') {
+		return err
+	}
+	b, err = readByte(ctx)
+	if err != nil {
+		return err
+	}
+	switch b {
+	case 'A':
+		e.recall(s, -1)
+	case 'B':
+		e.recall(s, 1)
+	case 'C':
+		if s.pos < len(s.buf) {
+			s.pos++
+		}
+	case 'D':
+		if s.pos > 0 {
+			s.pos--
+		}
+	case 'H':
+		s.pos = 0
+	case 'F':
+		s.pos = len(s.buf)
+	case '1', '3', '4', '7', '8':
+		// ESC [ n ~
+		if t, err := readByte(ctx); err != nil || t != '~' {
+			return err
+		}
+		switch b {
+		case '1', '7':
+			s.pos = 0
+		case '4', '8':
+			s.pos = len(s.buf)
+		case '3':
+			s.deleteAt(s.pos)
+		}
+	}
+	return nil
+}
+
+// recall replaces the line with the previous (dir -1) or next (dir 1)
+// history entry. The line being typed is kept while browsing.
+func (e *lineEditor) recall(s *editState, dir int) {
+	i := s.historyIndex + dir
+	if i < 0 || i > len(e.history) {
+		return
+	}
+	if s.historyIndex == len(e.history) {
+		s.typed = s.buf
+	}
+	s.historyIndex = i
+	if i == len(e.history) {
+		s.buf = s.typed
+	} else {
+		s.buf = []rune(e.history[i])
+	}
+	s.pos = len(s.buf)
+}
+
+// completeWord completes the word before the cursor. A single candidate is
+// filled in with a trailing space; several are filled in up to their common
+// prefix, and listed if that doesn't add anything.
+func (e *lineEditor) completeWord(ctx context.Context, s *editState) {
+	if e.complete == nil {
+		return
+	}
+	start := s.wordStart()
+	word := string(s.buf[start:s.pos])
+	before := strings.Fields(string(s.buf[:start]))
+	candidates := e.complete(ctx, before, word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	fill := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		fill += " "
+	}
+	if fill != word && strings.HasPrefix(fill, word) {
+		for _, r := range fill[len(word):] {
+			s.insert(r)
+		}
+		return
+	}
+	fmt.Print("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			// drop whole characters, so the prefix stays valid UTF-8
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// editState is the line being edited.
+type editState struct {
+	prompt       string
+	buf          []rune
+	pos          int
+	historyIndex int
+	typed        []rune
+}
+
+func (s *editState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *editState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
+
+func (s *editState) wordStart() int {
+	return wordStartAt(s.buf, s.pos)
+}
+
+func wordStartAt(buf []rune, pos int) int {
+	for pos > 0 && buf[pos-1] != ' ' {
+		pos--
+	}
+	return pos
+}
+
+// refresh redraws the prompt and line and puts the cursor back in place.
+func (s *editState) refresh() {
+	fmt.Print("\r" + s.prompt + string(s.buf) + "\033[K")
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Printf("\033[%dD", back)
+	}
+}
+
+// readRune reads one UTF-8 encoded character from stdin.
+func readRune(ctx context.Context) (rune, error) {
+	b, err := readByte(ctx)
+	if err != nil || b < utf8.RuneSelf {
+		return rune(b), err
+	}
+	p := []byte{b}
+	for !utf8.FullRune(p) {
+		b, err := readByte(ctx)
+		if err != nil {
+			return 0, err
+		}
+		p = append(p, b)
+	}
+	r, _ := utf8.DecodeRune(p)
+	return r, nil
+}
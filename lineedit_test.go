@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"throughput"}, "throughput"},
+		{[]string{"teardown", "ttl", "throughput"}, "t"},
+		{[]string{"database-v3", "database-v4"}, "database-v"},
+		{[]string{"index", "import", "integrity"}, "i"},
+		{[]string{"query", "script"}, ""},
+		{[]string{"same", "same"}, "same"},
+		{[]string{"abc", "ab"}, "ab"},
+		{[]string{"", "abc"}, ""},
+		// é and è share their first byte, which alone isn't a character
+		{[]string{"café", "cafè"}, "caf"},
+	}
+	for _, tt := range tests {
+		if got := commonPrefix(tt.words); got != tt.want {
+			t.Errorf("commonPrefix(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+func editing(line string, pos int) *editState {
+	return &editState{buf: []rune(line), pos: pos}
+}
+
+func TestEditStateInsert(t *testing.T) {
+	tests := []struct {
+		line    string
+		pos     int
+		r       rune
+		want    string
+		wantPos int
+	}{
+		{"", 0, 'a', "a", 1},
+		{"ac", 1, 'b', "abc", 2},
+		{"bc", 0, 'a', "abc", 1},
+		{"ab", 2, 'c', "abc", 3},
+		{"caf", 3, 'é', "café", 4},
+	}
+	for _, tt := range tests {
+		s := editing(tt.line, tt.pos)
+		s.insert(tt.r)
+		if string(s.buf) != tt.want || s.pos != tt.wantPos {
+			t.Errorf("insert %q into %q at %d = %q at %d, want %q at %d", tt.r, tt.line, tt.pos, string(s.buf), s.pos, tt.want, tt.wantPos)
+		}
+	}
+}
+
+func TestEditStateDeleteAt(t *testing.T) {
+	tests := []struct {
+		line string
+		i    int
+		want string
+	}{
+		{"abc", 0, "bc"},
+		{"abc", 1, "ac"},
+		{"abc", 2, "ab"},
+		{"abc", 3, "abc"}, // Delete at the end of the line does nothing
+		{"", 0, ""},
+		{"né", 1, "n"},
+	}
+	for _, tt := range tests {
+		s := editing(tt.line, 0)
+		s.deleteAt(tt.i)
+		if string(s.buf) != tt.want {
+			t.Errorf("deleteAt(%d) of %q = %q, want %q", tt.i, tt.line, string(s.buf), tt.want)
+		}
+	}
+}
+
+func TestWordStart(t *testing.T) {
+	tests := []struct {
+		line string
+		pos  int
+		want int
+	}{
+		{"", 0, 0},
+		{"create", 6, 0},
+		{"create data", 11, 7},
+		{"create data", 9, 7},
+		{"create ", 7, 7},
+		{"create  x", 9, 8},
+	}
+	for _, tt := range tests {
+		if got := editing(tt.line, tt.pos).wordStart(); got != tt.want {
+			t.Errorf("wordStart of %q at %d = %d, want %d", tt.line, tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestRecall(t *testing.T) {
+	e := &lineEditor{history: []string{"list", "create 4"}}
+	s := &editState{buf: []rune("tea"), pos: 3, historyIndex: len(e.history)}
+
+	steps := []struct {
+		dir  int
+		want string
+	}{
+		{-1, "create 4"},
+		{-1, "list"},
+		{-1, "list"}, // no older entry
+		{1, "create 4"},
+		{1, "tea"}, // back to the line being typed
+		{1, "tea"},
+	}
+	for i, step := range steps {
+		e.recall(s, step.dir)
+		if string(s.buf) != step.want || s.pos != len(s.buf) {
+			t.Fatalf("step %d: line %q at %d, want %q at the end", i, string(s.buf), s.pos, step.want)
+		}
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	e := &lineEditor{}
+	for _, line := range []string{"list", "list", "", "create 4", "list"} {
+		e.addHistory(line)
+	}
+	want := []string{"list", "create 4", "list"}
+	if len(e.history) != len(want) {
+		t.Fatalf("history = %q, want %q", e.history, want)
+	}
+	for i := range want {
+		if e.history[i] != want[i] {
+			t.Fatalf("history = %q, want %q", e.history, want)
+		}
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	complete := func(ctx context.Context, before []string, word string) []string {
+		var names []string
+		for _, name := range []string{"database-v3", "database-v4", "throughput"} {
+			if len(name) >= len(word) && name[:len(word)] == word {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	e := &lineEditor{complete: complete}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"create dat", "create database-v"},
+		{"thr", "throughput "},
+		{"create x", "create x"},
+	}
+	for _, tt := range tests {
+		s := editing(tt.line, len([]rune(tt.line)))
+		e.completeWord(context.Background(), s)
+		if string(s.buf) != tt.want || s.pos != len(s.buf) {
+			t.Errorf("completing %q = %q at %d, want %q", tt.line, string(s.buf), s.pos, tt.want)
+		}
+	}
+}
@@ -4,34 +4,69 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
 )
 
 func main() {
-	if err := run(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var opts globalOptions
+	flag.StringVar(&opts.ConfigPath, "config", defaultConfigPath(), "path to the config file")
+	flag.StringVar(&opts.Profile, "profile", os.Getenv("AZURE_COSMOS_PROFILE"), "name of the connection profile to use")
+	flag.BoolVar(&opts.Emulator, "emulator", false, "connect to the local Cosmos DB emulator")
+	flag.StringVar(&opts.CACertFile, "ca-cert", "", "PEM file with additional CA certificates to trust")
+	flag.BoolVar(&opts.InsecureSkipVerify, "insecure-skip-verify", false, "skip TLS verification (localhost endpoints only)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "show what deletes and replaces would change without changing anything")
+	flag.BoolVar(&opts.Backup, "backup", false, "export data before deleting it")
+	flag.StringVar(&opts.BackupDir, "backup-dir", defaultBackupDir, "directory for --backup and export output")
+	flag.BoolVar(&opts.QueryMetrics, "query-metrics", false, "show query execution metrics for each page of a query, and totals across pages")
+	flag.StringVar(&opts.Auth, "auth", "", "auth mode: key, default, azure-cli, managed-identity, service-principal, workload-identity or resource-token")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := run(ctx, opts, flag.Args()); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Println("interrupted")
+			os.Exit(130)
+		}
 		log.Fatal(err)
 	}
 }
 
-func run() error {
-	databaseName := "database-v4"
-	containerName := "customer"
+func run(ctx context.Context, opts globalOptions, args []string) error {
+	if len(args) > 0 {
+		return runCommand(ctx, opts, args)
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	databaseName := p.database("database-v4")
+	containerName := p.container("customer")
 
-	client, err := newClientFromEnviroment()
+	client, err := newClient(p)
 	if err != nil {
 		return err
 	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	guard := newSafety(opts, p, rc)
 
 	prompt := `-----------------------------------------
 Azure Cosmos DB Golang SDK Examples
@@ -46,332 +81,286 @@ Azure Cosmos DB Golang SDK Examples
 [h]   Create new order and update order total
 [i]   Delete order and update order total
 [j]   Query top 10 customers
+[o]   Create new order and update order total server-side
 -------------------------------------------
 [k]   Create databases and containers
 [l]   Upload data to containers
 [m]   Delete databases and containers
+[n]   Browse databases and containers
 -------------------------------------------
+[?]   Help, or help <command>
 [x]   Exit
-
-> `
+`
 
 	// TODO:
-	//  - clear the terminal screen after selection, press any key to return etc.
 	//  - order map return json
 
-out:
+	sh := &shell{
+		opts:          opts,
+		client:        client,
+		rc:            rc,
+		guard:         guard,
+		databaseName:  databaseName,
+		containerName: containerName,
+		provisioning:  p.provisioning(),
+	}
+	editor := newLineEditor(defaultHistoryPath(), sh.complete)
+
 	for {
 		fmt.Print("\n" + prompt)
-		result := ""
-		fmt.Scanln((&result))
+		result, err := editor.readLine(ctx, "> ")
+		if err == io.EOF {
+			fmt.Println("exiting...")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		args, err := splitArgs(result)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "x" || args[0] == "exit" {
+			fmt.Println("exiting...")
+			return nil
+		}
 		fmt.Printf("\nYour selection is: %v\n\n", result)
 
-		switch result {
-		case "a":
-			pk := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
-			databaseName := "database-v2"
-			containerName := "customer"
-			err := queryCustomer(client, containerName, databaseName, pk)
-			if err != nil {
-				return err
-			}
-
-		case "b":
-			pk := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
-			id := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
-			databaseName := "database-v2"
-			containerName := "customer"
-			item, err := getCustomer(client, databaseName, containerName, pk, id)
-			if err != nil {
-				return err
-			}
-			b, err := json.MarshalIndent(item, "", "    ")
-			if err != nil {
-				return err
-			}
-			fmt.Printf("%s\n", b)
-
-		case "c":
-			databaseName := "database-v2"
-			containerName := "productCategory"
-			err := ListAllProductCategories(client, containerName, databaseName)
-			if err != nil {
-				return err
-			}
-
-		case "d":
-			databaseName := "database-v4"
-			containerName := "product"
-			err := QueryProductsByCategoryId(client, databaseName, containerName)
-			if err != nil {
-				return err
-			}
-
-		case "e":
-			// TODO - need to validate if the logic is correct
-			//Change feed is a good option here
-			databaseName := "database-v3"
-			err := QueryProductsForCategory(client, databaseName, "product")
-			if err != nil {
-				return err
-			}
-			categoryId := "86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4"
-			categoryName1 := "Accessories, Tires and Tubes"
-			categoryName2 := "Accessories, Tires & Tubes"
-			err = UpdateCategoryName(client, databaseName, categoryId, categoryName1)
-			if err != nil {
-				return err
-			}
-			err = QueryProductsForCategory(client, databaseName, "product")
-			if err != nil {
-				return err
-			}
-			err = UpdateCategoryName(client, databaseName, categoryId, categoryName2)
-			if err != nil {
-				return err
-			}
-			err = RevertProductCategory(client, databaseName, "productCategory")
-			if err != nil {
-				return err
-			}
-
-		case "f":
-			databaseName := "database-v4"
-			containerName := "customer"
-			err := QuerySalesOrdersByCustomerId(client, containerName, databaseName)
-			if err != nil {
-				return err
-			}
-
-		case "g":
-			databaseName := "database-v4"
-			containerName := "customer"
-			err := QueryCustomerAndSalesOrdersByCustomerId(client, containerName, databaseName)
-			if err != nil {
-				return err
-			}
-
-		case "h":
-			// salesOrder
-			// TODO: Autogenerate dates for orderDate and +7 days for shipping
-			b := `
-			{
-				"customerId": "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161",
-				"details": [
-					{
-						"name": "Road-550-W Yellow, 42",
-						"price": 1120.49,
-						"quantity": 1,
-						"sku": "BK-R64Y-42"
-					},
-					{
-						"name": "Sport-100 Helmet, Blue",
-						"price": 34.99,
-						"quantity": 1,
-						"sku": "HL-U509-B"
-					}
-				],
-				"id": "",
-				"orderDate": "2014-02-16T00:00:00",
-				"shipDate": "2014-02-23T00:00:00",
-				"type": "salesOrder"
-			}			
-			`
-
-			item := map[string]interface{}{}
-			err := json.Unmarshal([]byte(b), &item)
-			if err != nil {
+		// errors are reported and the menu shown again; only an
+		// interrupt ends the session
+		if err := sh.dispatch(ctx, args); err != nil {
+			if ctx.Err() != nil {
 				return err
 			}
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
 
-			// get the customerID so we can update the
-			// customer's salesOrderQuantity
-			customerID := ""
-			if item, ok := item["customerId"]; ok {
-				if val, ok := item.(string); ok {
-					customerID = val
-				}
-			}
+// menuOption runs one of the lettered menu options.
+func (s *shell) menuOption(ctx context.Context, choice string) error {
+	client, rc, guard := s.client, s.rc, s.guard
+	databaseName, containerName := s.databaseName, s.containerName
+
+	switch choice {
+	case "a":
+		pk := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
+		databaseName := "database-v2"
+		containerName := "customer"
+		err := queryCustomer(ctx, client, containerName, databaseName, pk)
+		if err != nil {
+			return err
+		}
 
-			if customerID == "" {
-				return errors.New("customerID is empty")
-			}
+	case "b":
+		pk := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
+		id := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
+		databaseName := "database-v2"
+		containerName := "customer"
+		item, err := getCustomer(ctx, client, databaseName, containerName, pk, id)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(item, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
 
-			// create a new order from the above sample snippet
+	case "c":
+		databaseName := "database-v2"
+		containerName := "productCategory"
+		err := ListAllProductCategories(ctx, client, containerName, databaseName)
+		if err != nil {
+			return err
+		}
 
-			// We would have generated a new uuid using
-			// github.com/google/uuid as follows:
-			// orderID := uuid.New().String()
-			// Instead, we use a static orderID so we can delete later (option "i")
-			orderID := "8bdfc67f-2c68-40c5-9a36-2da649224c8b"
-			item["id"] = orderID
+	case "d":
+		databaseName := "database-v4"
+		containerName := "product"
+		err := QueryProductsByCategoryId(ctx, client, databaseName, containerName)
+		if err != nil {
+			return err
+		}
 
-			err = UpdateSalesOrderQty(client, databaseName, containerName, customerID, item)
-			if err != nil {
-				return err
-			}
+	case "e":
+		// TODO - need to validate if the logic is correct
+		//Change feed is a good option here
+		databaseName := "database-v3"
+		err := QueryProductsForCategory(ctx, client, databaseName, "product")
+		if err != nil {
+			return err
+		}
+		categoryId := "86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4"
+		categoryName1 := "Accessories, Tires and Tubes"
+		categoryName2 := "Accessories, Tires & Tubes"
+		err = UpdateCategoryName(ctx, client, guard, databaseName, categoryId, categoryName1)
+		if err != nil {
+			return err
+		}
+		err = QueryProductsForCategory(ctx, client, databaseName, "product")
+		if err != nil {
+			return err
+		}
+		err = UpdateCategoryName(ctx, client, guard, databaseName, categoryId, categoryName2)
+		if err != nil {
+			return err
+		}
+		err = RevertProductCategory(ctx, client, guard, databaseName, "productCategory")
+		if err != nil {
+			return err
+		}
 
-		case "i":
-			orderId := "8bdfc67f-2c68-40c5-9a36-2da649224c8b"
-			customerId := "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161"
-			if err := DeleteCustomerOrderAndUpdateSalesOrderQty(client, databaseName, containerName, orderId, customerId); err != nil {
-				return err
-			}
+	case "f":
+		databaseName := "database-v4"
+		containerName := "customer"
+		err := QuerySalesOrdersByCustomerId(ctx, client, containerName, databaseName)
+		if err != nil {
+			return err
+		}
 
-		case "j":
-			if err := GetTop10Customers(client, databaseName, containerName); err != nil {
-				return err
-			}
+	case "g":
+		databaseName := "database-v4"
+		containerName := "customer"
+		err := QueryCustomerAndSalesOrdersByCustomerId(ctx, client, containerName, databaseName)
+		if err != nil {
+			return err
+		}
 
-		case "k":
-			if err := CreateDatabase(client); err != nil {
-				return err
-			}
+	case "h":
+		item, customerID, err := sampleSalesOrder()
+		if err != nil {
+			return err
+		}
+		err = UpdateSalesOrderQty(ctx, client, guard, databaseName, containerName, customerID, item, orderOptions{})
+		if err != nil {
+			return err
+		}
 
-		case "l":
-			imports := []struct {
-				URL       string
-				PK        string
-				Database  string
-				Container string
-			}{
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/customer",
-					PK:        "id",
-					Database:  "database-v2",
-					Container: "customer",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/productCategory",
-					PK:        "type",
-					Database:  "database-v2",
-					Container: "productCategory",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v3/product",
-					PK:        "categoryId",
-					Database:  "database-v3",
-					Container: "product",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v3/productCategory",
-					PK:        "type",
-					Database:  "database-v3",
-					Container: "productCategory",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/customer",
-					PK:        "customerId",
-					Database:  "database-v4",
-					Container: "customer",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/product",
-					PK:        "categoryId",
-					Database:  "database-v4",
-					Container: "product",
-				},
-				{
-					URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/productMeta",
-					PK:        "type",
-					Database:  "database-v4",
-					Container: "productMeta",
-				},
-			}
+	case "i":
+		orderId := "8bdfc67f-2c68-40c5-9a36-2da649224c8b"
+		customerId := "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161"
+		if err := DeleteCustomerOrderAndUpdateSalesOrderQty(ctx, client, guard, databaseName, containerName, orderId, customerId, orderOptions{}); err != nil {
+			return err
+		}
 
-			for _, item := range imports {
-				// create the container
-				err := createContainer(client, item.Database, item.Container, "/"+item.PK)
-				if err != nil {
-					return err
-				}
-				// ImportData
-				log.Printf("importing Container %s from URL %s", item.Container, item.URL)
-				err = ImportData(client, item.URL, item.PK, item.Database, item.Container)
-				if err != nil {
-					return err
-				}
-			}
+	case "j":
+		if err := GetTop10Customers(ctx, client, databaseName, containerName, s.opts.QueryMetrics); err != nil {
+			return err
+		}
 
-		case "m":
-			if err := DeleteDatabase(client); err != nil {
-				return err
-			}
+	case "o":
+		item, customerID, err := sampleSalesOrder()
+		if err != nil {
+			return err
+		}
+		if err := CreateSalesOrderServerSide(ctx, rc, guard, databaseName, containerName, customerID, item); err != nil {
+			return err
+		}
 
-		case "x":
-			fmt.Println("exiting...")
-			break out
+	case "k":
+		selectors, err := readSelectors(ctx, "create")
+		if err != nil {
+			return err
+		}
+		// containers are billed for their throughput from the moment they
+		// exist, so only create them when asked to
+		fmt.Printf("Also create the sample containers, with %v? [y/N]: ", s.provisioning)
+		answer, err := readLine(ctx)
+		if err != nil {
+			return err
+		}
+		withContainers := strings.EqualFold(strings.TrimSpace(answer), "y")
+		if err := CreateDatabase(ctx, client, rc, selectors, withContainers, s.provisioning, containerPolicy{}); err != nil {
+			return err
+		}
 
-		case "delete-item":
-			pk := "category"
-			id := "9a4f11d3-a60b-4baf-b8c2-bf83c1ff404b"
-			_, err := deleteItem(client, "database-v4", "productMeta", pk, id)
+	case "l":
+		for _, item := range sampleContainers {
+			// create the container
+			err := createContainer(ctx, client, item.Database, item.Container, "/"+item.PK, s.provisioning, containerPolicy{})
 			if err != nil {
 				return err
 			}
-
-		case "test":
-			tmp := struct {
-				URL       string
-				PK        string
-				Database  string
-				Container string
-			}{
-				URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/customer",
-				PK:        "/id",
-				Database:  "database-v2",
-				Container: "customer",
-			}
-
-			err := createContainer(client, tmp.Database, tmp.Container, tmp.PK)
+			// ImportData
+			log.Printf("importing Container %s from URL %s", item.Container, item.URL)
+			err = ImportData(ctx, client, rc, item.URL, item.Database, item.Container, nil)
 			if err != nil {
 				return err
 			}
-
-		default:
-			return errors.New("command doesn't exist. exiting")
 		}
-	}
-	return nil
-}
 
-func newClientFromEnviroment() (*azcosmos.Client, error) {
-	endpoint := os.Getenv("AZURE_COSMOS_ENDPOINT")
-	if endpoint == "" {
-		return nil, errors.New("AZURE_COSMOS_ENDPOINT could not be found")
-	}
-
-	key := os.Getenv("AZURE_COSMOS_KEY")
-
-	if key != "" {
-
-		cred, err := azcosmos.NewKeyCredential(key)
+	case "m":
+		selectors, err := readSelectors(ctx, "delete")
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := DeleteDatabase(ctx, client, rc, guard, selectors); err != nil {
+			return err
+		}
+
+	case "n":
+		if err := browse(ctx, client, rc, guard); err != nil {
+			return err
 		}
 
-		client, err := azcosmos.NewClientWithKey(endpoint, cred, nil)
+	case "delete-item":
+		pk := "category"
+		id := "9a4f11d3-a60b-4baf-b8c2-bf83c1ff404b"
+		_, err := deleteItem(ctx, client, guard, "database-v4", "productMeta", pk, id)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		return client, nil
-	}
+	case "test":
+		tmp := struct {
+			URL       string
+			PK        string
+			Database  string
+			Container string
+		}{
+			URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/customer",
+			PK:        "/id",
+			Database:  "database-v2",
+			Container: "customer",
+		}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, err
-	}
+		err := createContainer(ctx, client, tmp.Database, tmp.Container, tmp.PK, s.provisioning, containerPolicy{})
+		if err != nil {
+			return err
+		}
 
-	client, err := azcosmos.NewClient(endpoint, cred, nil)
-	if err != nil {
-		return nil, err
+	default:
+		return errUnknownOption
 	}
+	return nil
+}
 
-	return client, nil
+// containerPolicy is what new containers are created with besides their
+// partition key and throughput.
+type containerPolicy struct {
+	// DefaultTTL is the container's default time to live in seconds; nil
+	// turns expiry off, and -1 turns it on with only items that set their
+	// own ttl expiring.
+	DefaultTTL *int32
+	// UniqueKeys are the paths of each unique key, e.g. {{"/emailAddress"}}. They
+	// can only be set when the container is created.
+	UniqueKeys [][]string
+	// SubPartitionKeys are further levels of a hierarchical partition key,
+	// e.g. {"/type"} under /customerId. See createHierarchicalContainer.
+	SubPartitionKeys []string
 }
 
-func createContainer(client *azcosmos.Client, databaseName string, containerName string, partitionKey string) error {
+// createContainer creates a container with throughput of its own, unless
+// prov shares the database's.
+func createContainer(ctx context.Context, client *azcosmos.Client, databaseName string, containerName string, partitionKey string, prov provisioning, policy containerPolicy) error {
+	if len(policy.SubPartitionKeys) > 0 {
+		return fmt.Errorf("container [%v]: the SDK can't create hierarchical partition keys, use createHierarchicalContainer", containerName)
+	}
 	log.Printf("\nCreating container [%v] in database [%v]\n", containerName, databaseName)
 
 	database, err := client.NewDatabase(databaseName)
@@ -384,15 +373,19 @@ func createContainer(client *azcosmos.Client, databaseName string, containerName
 		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{
 			Paths: []string{partitionKey},
 		},
+		DefaultTimeToLive: policy.DefaultTTL,
+		UniqueKeyPolicy:   uniqueKeyPolicy(policy.UniqueKeys),
+	}
+	containerOptions := &azcosmos.CreateContainerOptions{}
+	if !prov.Shared {
+		throughput := prov.properties()
+		containerOptions.ThroughputProperties = &throughput
 	}
-	throughput := azcosmos.NewManualThroughputProperties(400)
 
-	containerResp, err := database.CreateContainer(context.Background(), containerProperties, &azcosmos.CreateContainerOptions{ThroughputProperties: &throughput})
+	containerResp, err := database.CreateContainer(ctx, containerProperties, containerOptions)
 
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
-		if responseErr.ErrorCode == "Conflict" {
+		if isConflict(err) {
 			log.Printf("Container [%v] already exists\n", containerName)
 		} else {
 			return err
@@ -403,8 +396,27 @@ func createContainer(client *azcosmos.Client, databaseName string, containerName
 	return nil
 }
 
-func deleteItem(client *azcosmos.Client, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
-	pk := azcosmos.NewPartitionKeyString(partitionKey)
+func deleteItem(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
+	return deleteItemByKey(ctx, client, guard, databaseName, containerName, azcosmos.NewPartitionKeyString(partitionKey), id)
+}
+
+// deleteItemByKey is deleteItem for a partition key of any type.
+func deleteItemByKey(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName string, pk azcosmos.PartitionKey, id string) (map[string]interface{}, error) {
+	item, err := pointReadByKey(ctx, client, databaseName, containerName, pk, id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	ok, err := guard.confirmDelete(ctx, "item", id, string(b))
+	if !ok {
+		return nil, err
+	}
+	if err := guard.backupItem(databaseName, containerName, id, item); err != nil {
+		return nil, err
+	}
 
 	log.Printf("Executing a delete against PK [%v] and ID [%v]\n", pk, id)
 
@@ -413,17 +425,15 @@ func deleteItem(client *azcosmos.Client, databaseName, containerName, partitionK
 		return nil, err
 	}
 
-	itemResponse, err := container.DeleteItem(context.Background(), pk, id, nil)
+	itemResponse, err := container.DeleteItem(ctx, pk, id, nil)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
 		return nil, err
 	}
 	log.Printf("Item [%v] deleted. Status %d. ActivityId %s. Consuming %v RU\n", id, itemResponse.RawResponse.StatusCode, itemResponse.ActivityID, itemResponse.RequestCharge)
-	return nil, err
+	return item, nil
 }
 
-func queryCustomer(client *azcosmos.Client, containerName, databaseName, partitionKey string) error {
+func queryCustomer(ctx context.Context, client *azcosmos.Client, containerName, databaseName, partitionKey string) error {
 	//Querying for a single customer
 	pk := azcosmos.NewPartitionKeyString(partitionKey)
 
@@ -437,7 +447,7 @@ func queryCustomer(client *azcosmos.Client, containerName, databaseName, partiti
 	queryPager := container.NewQueryItemsPager("select * from customer c", pk, nil)
 
 	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
+		queryResponse, err := queryPager.NextPage(ctx)
 		if err != nil {
 			return err
 		}
@@ -458,7 +468,7 @@ func queryCustomer(client *azcosmos.Client, containerName, databaseName, partiti
 	return nil
 }
 
-func getCustomer(client *azcosmos.Client, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
+func getCustomer(ctx context.Context, client *azcosmos.Client, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
 	pk := azcosmos.NewPartitionKeyString(partitionKey)
 
 	log.Printf("\nExecuting a point read against:\n PK: %v \n ID: %v\n\n", pk, id)
@@ -468,10 +478,8 @@ func getCustomer(client *azcosmos.Client, databaseName, containerName, partition
 		return nil, err
 	}
 
-	itemResponse, err := container.ReadItem(context.Background(), pk, id, nil)
+	itemResponse, err := container.ReadItem(ctx, pk, id, nil)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
 		return nil, err
 	}
 
@@ -484,79 +492,37 @@ func getCustomer(client *azcosmos.Client, databaseName, containerName, partition
 	return item, nil
 }
 
-func ListAllProductCategories(client *azcosmos.Client, containerName, databaseName string) error {
-	//Get all product categories
-	query := "SELECT * FROM c WHERE c.type = 'category'"
-	pk := azcosmos.NewPartitionKeyString("category")
+// categoriesQuery selects the product categories from the "category"
+// partition of productCategory or productMeta.
+const categoriesQuery = "SELECT * FROM c WHERE c.type = 'category'"
 
+func ListAllProductCategories(ctx context.Context, client *azcosmos.Client, containerName, databaseName string) error {
 	log.Printf("Print out all categories in %v\\%v\n", databaseName, containerName)
 
-	container, err := client.NewContainer(databaseName, containerName)
+	items, err := queryItems(ctx, client, databaseName, containerName, categoriesQuery, "category")
 	if err != nil {
 		return err
 	}
-
-	queryPager := container.NewQueryItemsPager(query, pk, &azcosmos.QueryOptions{PopulateIndexMetrics: true})
-	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
-		if err != nil {
-			return err
-		}
-		for _, item := range queryResponse.Items {
-			map1 := map[string]interface{}{}
-			err := json.Unmarshal(item, &map1)
-			if err != nil {
-				return err
-			}
-			b, err := json.MarshalIndent(map1, "", "    ")
-			if err != nil {
-				return err
-			}
-			fmt.Printf("%s\n", b)
-		}
-		log.Printf("Query page received with %d items. Status %d. ActivityId %s. Consuming %v RU\n", len(queryResponse.Items), queryResponse.RawResponse.StatusCode, queryResponse.ActivityID, queryResponse.RequestCharge)
-	}
-	return nil
+	return printItems(items)
 }
 
-func QueryProductsByCategoryId(client *azcosmos.Client, databaseName, containerName string) error {
+func QueryProductsByCategoryId(ctx context.Context, client *azcosmos.Client, databaseName, containerName string) error {
 	//Category Name = Accessories, Tires and Tubes
-	pk := azcosmos.NewPartitionKeyString("86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4")
+	categoryID := "86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4"
 
-	log.Printf("Retreiving all products by categoryId [%v] in [%v\\%v]", pk, databaseName, containerName)
-	container, err := client.NewContainer(databaseName, containerName)
-	if err != nil {
-		return err
-	}
+	log.Printf("Retreiving all products by categoryId [%v] in [%v\\%v]", categoryID, databaseName, containerName)
 	//Query for products by category id
-	queryPager := container.NewQueryItemsPager("select * from c", pk, nil)
-	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
-		if err != nil {
-			return err
-		}
-		for _, item := range queryResponse.Items {
-			map1 := map[string]interface{}{}
-			err := json.Unmarshal(item, &map1)
-			if err != nil {
-				return err
-			}
-			b, err := json.MarshalIndent(map1, "", "    ")
-			if err != nil {
-				return err
-			}
-			fmt.Printf("%s\n", b)
-		}
-		log.Printf("Query page received with %d items. Status %d. ActivityId %s. Consuming %v RU\n", len(queryResponse.Items), queryResponse.RawResponse.StatusCode, queryResponse.ActivityID, queryResponse.RequestCharge)
-	}
-	return nil
+	title := fmt.Sprintf("Products in category %v in %v\\%v", categoryID, databaseName, containerName)
+	return viewPages(ctx, title, func(ctx context.Context, continuation string) (queryPage, error) {
+		return queryItemsPage(ctx, client, databaseName, containerName, "select * from c", categoryID, viewerPageSize, continuation)
+	})
 }
 
-func RefreshProductCategory(client *azcosmos.Client, databaseName, containerName string) error {
+func RefreshProductCategory(ctx context.Context, client *azcosmos.Client, databaseName, containerName string) error {
 	return nil
 }
 
-func QueryProductsForCategory(client *azcosmos.Client, databaseName, containerName string) error {
+func QueryProductsForCategory(ctx context.Context, client *azcosmos.Client, databaseName, containerName string) error {
 	categoryId := "86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4"
 	pk := azcosmos.NewPartitionKeyString(categoryId)
 
@@ -574,7 +540,7 @@ func QueryProductsForCategory(client *azcosmos.Client, databaseName, containerNa
 
 	queryPager := container.NewQueryItemsPager(query, pk, &azcosmos.QueryOptions{PopulateIndexMetrics: true})
 	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
+		queryResponse, err := queryPager.NextPage(ctx)
 		if err != nil {
 			return err
 		}
@@ -595,14 +561,19 @@ func QueryProductsForCategory(client *azcosmos.Client, databaseName, containerNa
 	return nil
 }
 
-func UpdateCategoryName(client *azcosmos.Client, databaseName, categoryID, categoryName string) error {
+func UpdateCategoryName(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, categoryID, categoryName string) error {
 	containerName := "productCategory"
 	pkName := "category"
-	item, err := pointRead(client, databaseName, containerName, pkName, categoryID)
+	item, err := pointRead(ctx, client, databaseName, containerName, pkName, categoryID)
 	if err != nil {
 		return err
 	}
 
+	ok, err := guard.allowWrite(fmt.Sprintf("replace category [%v] name %q with %q in %v\\%v", categoryID, item["value"], categoryName, databaseName, containerName))
+	if !ok {
+		return err
+	}
+
 	// update value ie. fields id, type, value
 	item["value"] = categoryName
 
@@ -617,7 +588,7 @@ func UpdateCategoryName(client *azcosmos.Client, databaseName, categoryID, categ
 	}
 
 	pk := azcosmos.NewPartitionKeyString(pkName)
-	res, err := container.UpsertItem(context.Background(), pk, b, nil)
+	res, err := container.UpsertItem(ctx, pk, b, nil)
 	if err != nil {
 		return err
 	}
@@ -626,11 +597,16 @@ func UpdateCategoryName(client *azcosmos.Client, databaseName, categoryID, categ
 	return nil
 }
 
-func RevertProductCategory(client *azcosmos.Client, databaseName, containerName string) error {
+func RevertProductCategory(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName string) error {
 
 	categoryId := "86F3CBAB-97A7-4D01-BABB-ADEFFFAED6B4" //Category Name = Accessories, Tires and Tubes
 	pk := azcosmos.NewPartitionKeyString("category")
 
+	ok, err := guard.allowWrite(fmt.Sprintf("replace category [%v] in %v\\%v with its original name", categoryId, databaseName, containerName))
+	if !ok {
+		return err
+	}
+
 	container, err := client.NewContainer(databaseName, containerName)
 	if err != nil {
 		return err
@@ -644,18 +620,18 @@ func RevertProductCategory(client *azcosmos.Client, databaseName, containerName
 
 	marshalled, err := json.MarshalIndent(item, "", "  ")
 	if err != nil {
-		fmt.Printf("Error parsing JSON string - %s", err)
+		return err
 	}
 
-	itemResponse, err := container.ReplaceItem(context.Background(), pk, categoryId, marshalled, &azcosmos.ItemOptions{EnableContentResponseOnWrite: true})
+	itemResponse, err := container.ReplaceItem(ctx, pk, categoryId, marshalled, &azcosmos.ItemOptions{EnableContentResponseOnWrite: true})
 	if err != nil {
-		fmt.Printf("Failed to replace item: %v", err)
+		return fmt.Errorf("replacing category [%v]: %w", categoryId, err)
 	}
 	fmt.Printf("Change category name back to the original (Accessories, Tires and Tubes)\n")
 	log.Printf("Item [%v] read. Status %d. ActivityId %s. Consuming %v RU\n", categoryId, itemResponse.RawResponse.StatusCode, itemResponse.ActivityID, itemResponse.RequestCharge)
 
 	id := categoryId
-	item1, err := pointRead(client, "database-v3", "productCategory", "category", id)
+	item1, err := pointRead(ctx, client, "database-v3", "productCategory", "category", id)
 	if err != nil {
 		return err
 	}
@@ -668,41 +644,51 @@ func RevertProductCategory(client *azcosmos.Client, databaseName, containerName
 	return nil
 }
 
-func QuerySalesOrdersByCustomerId(client *azcosmos.Client, containerName, databaseName string) error {
-	pk := azcosmos.NewPartitionKeyString("FFD0DD37-1F0E-4E2E-8FAC-EAF45B0E9447")
+func QuerySalesOrdersByCustomerId(ctx context.Context, client *azcosmos.Client, containerName, databaseName string) error {
+	customerID := "FFD0DD37-1F0E-4E2E-8FAC-EAF45B0E9447"
 
-	log.Printf("Print out all sales orders for customer with PK [%v] in %v\\%v\n", pk, databaseName, containerName)
+	log.Printf("Print out all sales orders for customer with PK [%v] in %v\\%v\n", customerID, databaseName, containerName)
 
-	container, err := client.NewContainer(databaseName, containerName)
+	title := fmt.Sprintf("Sales orders for customer %v in %v\\%v", customerID, databaseName, containerName)
+	return viewPages(ctx, title, func(ctx context.Context, continuation string) (queryPage, error) {
+		return queryItemsPage(ctx, client, databaseName, containerName, salesOrdersQuery, customerID, viewerPageSize, continuation)
+	})
+}
 
-	if err != nil {
-		return err
+// salesOrdersQuery selects a customer's orders from their partition of the
+// v4 customer container.
+const salesOrdersQuery = "SELECT * from c WHERE c.type = 'salesOrder'"
+
+// queryItems runs a query against a single partition and returns every item
+// it matches, fetching page after page.
+func queryItems(ctx context.Context, client *azcosmos.Client, databaseName, containerName, query, partitionKey string) ([]map[string]interface{}, error) {
+	items := []map[string]interface{}{}
+	continuation := ""
+	for {
+		page, err := queryItemsPage(ctx, client, databaseName, containerName, query, partitionKey, 0, continuation)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		continuation = page.Continuation
+		if continuation == "" {
+			return items, nil
+		}
 	}
-	query := "SELECT * from c WHERE c.type = 'salesOrder'"
-	queryPager := container.NewQueryItemsPager(query, pk, &azcosmos.QueryOptions{PopulateIndexMetrics: true})
-	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
+}
+
+func printItems(items []map[string]interface{}) error {
+	for _, item := range items {
+		b, err := json.MarshalIndent(item, "", "    ")
 		if err != nil {
 			return err
 		}
-		for _, item := range queryResponse.Items {
-			map1 := map[string]interface{}{}
-			err := json.Unmarshal(item, &map1)
-			if err != nil {
-				return err
-			}
-			b, err := json.MarshalIndent(map1, "", "    ")
-			if err != nil {
-				return err
-			}
-			fmt.Printf("%s\n", b)
-		}
-		log.Printf("Query page received with %d items. Status %d. ActivityId %s. Consuming %v RU\n", len(queryResponse.Items), queryResponse.RawResponse.StatusCode, queryResponse.ActivityID, queryResponse.RequestCharge)
+		fmt.Printf("%s\n", b)
 	}
 	return nil
 }
 
-func QueryCustomerAndSalesOrdersByCustomerId(client *azcosmos.Client, containerName, databaseName string) error {
+func QueryCustomerAndSalesOrdersByCustomerId(ctx context.Context, client *azcosmos.Client, containerName, databaseName string) error {
 	pk := azcosmos.NewPartitionKeyString("FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF")
 
 	log.Printf("Print out customer record PK [%v] and all their sales orders in %v\\%v\n", pk, databaseName, containerName)
@@ -714,7 +700,7 @@ func QueryCustomerAndSalesOrdersByCustomerId(client *azcosmos.Client, containerN
 	query := "select * from c"
 	queryPager := container.NewQueryItemsPager(query, pk, &azcosmos.QueryOptions{PopulateIndexMetrics: true})
 	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
+		queryResponse, err := queryPager.NextPage(ctx)
 		if err != nil {
 			return err
 		}
@@ -735,7 +721,7 @@ func QueryCustomerAndSalesOrdersByCustomerId(client *azcosmos.Client, containerN
 	return nil
 }
 
-func CreateNewOrder(client *azcosmos.Client, databaseName, containerName, id string, item map[string]interface{}) error {
+func CreateNewOrder(ctx context.Context, client *azcosmos.Client, databaseName, containerName, id string, item map[string]interface{}) error {
 	log.Printf("Creating a new Order %v in %v\\%v\n", id, databaseName, containerName)
 
 	container, err := client.NewContainer(databaseName, containerName)
@@ -748,18 +734,14 @@ func CreateNewOrder(client *azcosmos.Client, databaseName, containerName, id str
 		return err
 	}
 	pk := azcosmos.NewPartitionKeyString(id)
-	ctx := context.Background()
 	options := &azcosmos.ItemOptions{EnableContentResponseOnWrite: false}
 
 	itemResponse, err := container.CreateItem(ctx, pk, b, options)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		if errors.As(err, &responseErr) {
-			if responseErr.ErrorCode == "Conflict" {
-				log.Printf("Customer order already exists: %s\n", id)
-			} else {
-				return err
-			}
+		if isConflict(err) {
+			log.Printf("Customer order already exists: %s\n", id)
+		} else {
+			return err
 		}
 	} else {
 		map1 := map[string]interface{}{}
@@ -777,27 +759,20 @@ func CreateNewOrder(client *azcosmos.Client, databaseName, containerName, id str
 	return nil
 }
 
-func DeleteCustomerOrder(client *azcosmos.Client, databaseName, containerName, orderId, customerId string) error {
-	pk := azcosmos.NewPartitionKeyString(customerId)
-
-	log.Printf("Deleting customer order %v\n", customerId)
-
-	container, err := client.NewContainer(databaseName, containerName)
-	if err != nil {
-		return err
-	}
-
-	itemResponse, err := container.DeleteItem(context.Background(), pk, orderId, nil)
-	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
-		return err
-	}
-	log.Printf("Customer Order [%v] deleted. Status %d. ActivityId %s. Consuming %v RU\n", customerId, itemResponse.RawResponse.StatusCode, itemResponse.ActivityID, itemResponse.RequestCharge)
+// DeleteCustomerOrder deletes one order of a customer through the same
+// confirmation, backup, dry-run and protected profile checks as other
+// deletes. Unlike DeleteCustomerOrderAndUpdateSalesOrderQty it leaves the
+// customer's salesOrderCount alone.
+func DeleteCustomerOrder(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName, orderId, customerId string) error {
+	log.Printf("Deleting order %v of customer %v\n", orderId, customerId)
+	_, err := deleteItemByKey(ctx, client, guard, databaseName, containerName, azcosmos.NewPartitionKeyString(customerId), orderId)
 	return err
 }
 
-func GetTop10Customers(client *azcosmos.Client, databaseName, containerName string) error {
+// GetTop10Customers runs an ORDER BY query, which is a good one to look at
+// with showMetrics: sorting by salesOrderCount without a composite index
+// reads far more than it returns.
+func GetTop10Customers(ctx context.Context, client *azcosmos.Client, databaseName, containerName string, showMetrics bool) error {
 	//Query to get our top 10 customers. Currently only for a single customer id.
 	//TODO - Need to return all customers and pull out customer name and order qty and order by in code.
 	customerId := "FFCAE1E9-7E8D-457B-8435-BB7992C6D8BF"
@@ -814,11 +789,21 @@ func GetTop10Customers(client *azcosmos.Client, databaseName, containerName stri
 		"FROM c WHERE c.type = 'customer' " +
 		"ORDER BY c.salesOrderCount DESC"
 	queryPager := container.NewQueryItemsPager(query, pk, &azcosmos.QueryOptions{PopulateIndexMetrics: true})
+	var total queryMetrics
 	for queryPager.More() {
-		queryResponse, err := queryPager.NextPage(context.Background())
+		queryResponse, err := queryPager.NextPage(ctx)
 		if err != nil {
 			return err
 		}
+		if showMetrics && queryResponse.QueryMetrics != nil {
+			m, err := parseQueryMetrics(*queryResponse.QueryMetrics)
+			if err != nil {
+				return err
+			}
+			m.RequestCharge = float64(queryResponse.RequestCharge)
+			printQueryMetrics(os.Stdout, "Query metrics for this page", m)
+			total.add(m)
+		}
 		for _, item := range queryResponse.Items {
 			map1 := map[string]interface{}{}
 			err := json.Unmarshal(item, &map1)
@@ -834,85 +819,172 @@ func GetTop10Customers(client *azcosmos.Client, databaseName, containerName stri
 		}
 		log.Printf("Query page received with %d items. Status %d. ActivityId %s. Consuming %v RU\n", len(queryResponse.Items), queryResponse.RawResponse.StatusCode, queryResponse.ActivityID, queryResponse.RequestCharge)
 	}
+	if total.Pages > 1 {
+		printQueryMetrics(os.Stdout, "Query metrics for all pages", total)
+	}
 	return nil
 }
 
-func DeleteDatabase(client *azcosmos.Client) error {
-	var schemaVersionStart int = 1
-	var schemaVersionEnd int = 4
-	var schemaVersion = 0
-	if !(schemaVersion == 0) {
-		schemaVersionStart = schemaVersion
-		schemaVersionEnd = schemaVersion
-	} else {
-		schemaVersionStart = 1
-		schemaVersionEnd = 4
+// DeleteDatabase lists the account, then deletes the databases and containers
+// picked by the selectors.
+func DeleteDatabase(ctx context.Context, client *azcosmos.Client, rc *restClient, guard *safety, selectors []selector) error {
+	inv, err := listInventory(ctx, rc)
+	if err != nil {
+		return err
 	}
-	for schemaVersionCounter := schemaVersionStart; schemaVersionCounter <= schemaVersionEnd; schemaVersionCounter++ {
-		err := DeleteDatabaseAndContainers(client, "database-v"+strconv.Itoa(schemaVersionCounter))
-		if err != nil {
-			return err
+	inv.print(selectors)
+
+	for _, databaseName := range inv.databases() {
+		if selectsDatabase(selectors, databaseName) {
+			err := DeleteDatabaseAndContainers(ctx, client, guard, databaseName)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, containerName := range inv[databaseName] {
+			if !selectsContainer(selectors, databaseName, containerName) {
+				continue
+			}
+			err := deleteContainer(ctx, client, guard, databaseName, containerName)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func DeleteDatabaseAndContainers(client *azcosmos.Client, databaseName string) error {
+func DeleteDatabaseAndContainers(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName string) error {
 	db, _ := client.NewDatabase(databaseName)
-	//resp, err = db.Read(context.TODO(), nil)
-
-	var response string
-	fmt.Printf("Are you sure you want to delete [%v](Y/N) : ", databaseName)
-	fmt.Scanln((&response))
-	if strings.ContainsRune(response, 'y') || strings.ContainsRune(response, 'Y') {
-		resp, err := db.Delete(context.TODO(), nil)
-		_ = resp
-		if err != nil {
-			var responseErr *azcore.ResponseError
-			errors.As(err, &responseErr)
-			if responseErr.ErrorCode == "Conflict" {
-				log.Printf("Database [%v] already exists\n", databaseName)
-			} else {
-				return err
-			}
+
+	details, exists, err := guard.describeDatabase(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		log.Printf("Database [%v] does not exist\n", databaseName)
+		return nil
+	}
+
+	ok, err := guard.confirmDelete(ctx, "database", databaseName, details)
+	if !ok {
+		return err
+	}
+	if err := guard.backupDatabase(ctx, databaseName); err != nil {
+		return err
+	}
+
+	resp, err := db.Delete(ctx, nil)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Database [%v] does not exist\n", databaseName)
 		} else {
-			fmt.Printf("Database [%v] deleted. ActivityId %s\n", databaseName, resp.ActivityID)
+			return err
 		}
+	} else {
+		fmt.Printf("Database [%v] deleted. ActivityId %s\n", databaseName, resp.ActivityID)
 	}
 	return nil
 }
 
-func CreateDatabase(client *azcosmos.Client) error {
-	schemaVersionStart := 1
-	schemaVersionEnd := 4
-	schemaVersion := 0
-	if !(schemaVersion == 0) {
-		schemaVersionStart = schemaVersion
-		schemaVersionEnd = schemaVersion
-	} else {
-		schemaVersionStart = 1
-		schemaVersionEnd = 4
+func deleteContainer(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName string) error {
+	name := databaseName + "/" + containerName
+	ok, err := guard.confirmDelete(ctx, "container", name, guard.describeContainer(ctx, databaseName, containerName))
+	if !ok {
+		return err
+	}
+	if err := guard.backupContainer(ctx, databaseName, containerName); err != nil {
+		return err
+	}
+
+	container, err := client.NewContainer(databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	resp, err := container.Delete(ctx, nil)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Container [%v] does not exist\n", name)
+			return nil
+		}
+		return err
+	}
+	fmt.Printf("Container [%v] deleted. ActivityId %s\n", name, resp.ActivityID)
+	return nil
+}
+
+// CreateDatabase creates the schema databases picked by the selectors and,
+// withContainers, their sample containers, skipping containers that already
+// exist.
+func CreateDatabase(ctx context.Context, client *azcosmos.Client, rc *restClient, selectors []selector, withContainers bool, prov provisioning, policy containerPolicy) error {
+	inv, err := listInventory(ctx, rc)
+	if err != nil {
+		return err
 	}
-	for schemaVersionCounter := schemaVersionStart; schemaVersionCounter <= schemaVersionEnd; schemaVersionCounter++ {
-		fmt.Printf("Create started for schema %v\n", schemaVersionCounter)
-		err := CreateDatabaseAndContainers(client, "database-v"+strconv.Itoa(schemaVersionCounter), schemaVersionCounter)
+	inv.print(nil)
+
+	if withContainers {
+		if err := checkSubPartitions(inv, selectors, policy.SubPartitionKeys); err != nil {
+			return err
+		}
+	}
+
+	for _, schemaVersion := range schemaVersions {
+		databaseName := schemaDatabaseName(schemaVersion)
+		var containers []sampleContainer
+		for _, c := range sampleContainers {
+			if c.Database == databaseName && selectsContainer(selectors, c.Database, c.Container) {
+				containers = append(containers, c)
+			}
+		}
+		if !selectsDatabase(selectors, databaseName) && len(containers) == 0 {
+			continue
+		}
+
+		fmt.Printf("Create started for schema %v, %v\n", schemaVersion, prov)
+		err := CreateDatabaseAndContainers(ctx, client, databaseName, schemaVersion, prov)
 		if err != nil {
 			return err
 		}
+		if !withContainers {
+			continue
+		}
+		for _, c := range containers {
+			if inv.hasContainer(c.Database, c.Container) {
+				log.Printf("Container [%v] already exists\n", c.Container)
+				continue
+			}
+			var err error
+			if len(policy.SubPartitionKeys) > 0 {
+				var paths []string
+				if paths, err = hierarchicalPaths("/"+c.PK, policy.SubPartitionKeys); err == nil {
+					err = createHierarchicalContainer(ctx, rc, c.Database, c.Container, paths, prov, policy)
+				}
+			} else {
+				err = createContainer(ctx, client, c.Database, c.Container, "/"+c.PK, prov, policy)
+			}
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func CreateDatabaseAndContainers(client *azcosmos.Client, databaseName string, schema int) error {
+// CreateDatabaseAndContainers creates the database of a schema version, with
+// throughput for its containers to share if prov asks for it.
+func CreateDatabaseAndContainers(ctx context.Context, client *azcosmos.Client, databaseName string, schema int, prov provisioning) error {
 	if schema >= 1 && schema <= 4 {
-		//throughput := azcosmos.NewManualThroughputProperties(400)
 		databaseProperties := azcosmos.DatabaseProperties{ID: databaseName}
 		databaseOptions := &azcosmos.CreateDatabaseOptions{}
-		databaseResp, err := client.CreateDatabase(context.Background(), databaseProperties, databaseOptions)
+		if prov.Shared {
+			throughput := prov.properties()
+			databaseOptions.ThroughputProperties = &throughput
+		}
+		databaseResp, err := client.CreateDatabase(ctx, databaseProperties, databaseOptions)
 		if err != nil {
-			var responseErr *azcore.ResponseError
-			errors.As(err, &responseErr)
-			if responseErr.ErrorCode == "Conflict" {
+			if isConflict(err) {
 				log.Printf("Database [%v] already exists\n", databaseName)
 			} else {
 				return err
@@ -924,9 +996,12 @@ func CreateDatabaseAndContainers(client *azcosmos.Client, databaseName string, s
 	return nil
 }
 
-func pointRead(client *azcosmos.Client, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
-	pk := azcosmos.NewPartitionKeyString(partitionKey)
+func pointRead(ctx context.Context, client *azcosmos.Client, databaseName, containerName, partitionKey, id string) (map[string]interface{}, error) {
+	return pointReadByKey(ctx, client, databaseName, containerName, azcosmos.NewPartitionKeyString(partitionKey), id)
+}
 
+// pointReadByKey is pointRead for a partition key of any type.
+func pointReadByKey(ctx context.Context, client *azcosmos.Client, databaseName, containerName string, pk azcosmos.PartitionKey, id string) (map[string]interface{}, error) {
 	log.Printf("Executing a point read against: PK [%v] ID [%v] in [%v\\%v]\n", pk, id, databaseName, containerName)
 
 	container, err := client.NewContainer(databaseName, containerName)
@@ -934,10 +1009,8 @@ func pointRead(client *azcosmos.Client, databaseName, containerName, partitionKe
 		return nil, err
 	}
 
-	itemResponse, err := container.ReadItem(context.Background(), pk, id, nil)
+	itemResponse, err := container.ReadItem(ctx, pk, id, nil)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
 		return nil, err
 	}
 
@@ -950,39 +1023,79 @@ func pointRead(client *azcosmos.Client, databaseName, containerName, partitionKe
 	return item, nil
 }
 
-func ImportData(client *azcosmos.Client, url1, pk, databaseName, containerName string) error {
-
-	res, err := http.Get(url1)
+// ImportData imports the items at source, a URL or a .json or .ndjson file,
+// into the container. Partition keys are taken from each item at the paths
+// the container is partitioned by, after building any synthetic keys.
+func ImportData(ctx context.Context, client *azcosmos.Client, rc *restClient, source, databaseName, containerName string, synthetic []syntheticKey) (err error) {
+	items, err := readImportItems(ctx, source)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	return importItems(ctx, client, rc, items, databaseName, containerName, synthetic)
+}
 
-	b, err := io.ReadAll(res.Body)
+// importItems creates the items in the container, taking each item's
+// partition key from the paths of the container's partition key definition,
+// nested or not, after setting the synthetic keys. It checkpoints its
+// progress, so an interrupted import resumes where it stopped.
+func importItems(ctx context.Context, client *azcosmos.Client, rc *restClient, items []map[string]interface{}, databaseName, containerName string, synthetic []syntheticKey) (err error) {
+	db, err := client.NewDatabase(databaseName)
 	if err != nil {
 		return err
 	}
-
-	items := []map[string]interface{}{}
-	err = json.Unmarshal(b, &items)
+	container, err := db.NewContainer(containerName)
 	if err != nil {
 		return err
 	}
-	db, err := client.NewDatabase(databaseName)
+	// the SDK's container properties only give the paths, and it can't write
+	// to hierarchically partitioned containers, so the definition is read
+	// and those go through the REST client with every level of the key
+	info, err := rc.readContainer(ctx, databaseName, containerName)
 	if err != nil {
 		return err
 	}
-	container, err := db.NewContainer(containerName)
+	hierarchical := info.PartitionKey.hierarchical()
+
+	// resume from the last checkpoint, and record how far we got however we exit
+	progress, err := loadCheckpoints()
 	if err != nil {
 		return err
 	}
-
-	ctx := context.Background()
+	// before the synthetic keys change the items
+	checkpointKey, err := importCheckpointKey(databaseName, containerName, items)
+	if err != nil {
+		return err
+	}
+	if progress.discardOthers(databaseName, containerName, checkpointKey) {
+		log.Printf("Discarding the checkpoint of an interrupted import of other items into %v\\%v\n", databaseName, containerName)
+	}
+	done := progress[checkpointKey]
+	if done > 0 {
+		log.Printf("Resuming import into %v\\%v after %d of %d items\n", databaseName, containerName, done, len(items))
+	}
+	defer func() {
+		if saveErr := progress.save(); err == nil {
+			err = saveErr
+		}
+		if ctx.Err() != nil {
+			log.Printf("Import into %v\\%v stopped after %d of %d items\n", databaseName, containerName, progress[checkpointKey], len(items))
+		}
+	}()
 
 	ruSum := 0.0
 	start := time.Now()
 
-	for _, item := range items {
+	for i := done; i < len(items); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item := items[i]
+		for _, key := range synthetic {
+			if err := key.apply(item); err != nil {
+				return err
+			}
+		}
+
 		// pretty print as we insert
 		b, err := json.MarshalIndent(item, "", "    ")
 		if err != nil {
@@ -990,22 +1103,39 @@ func ImportData(client *azcosmos.Client, url1, pk, databaseName, containerName s
 		}
 		fmt.Printf("%s\n", b)
 
+		values, err := partitionKeyValues(item, info.PartitionKey.Paths)
+		if err != nil {
+			return err
+		}
+
 		// insert the item
-		id, ok := item[pk]
-		if !ok {
-			return fmt.Errorf("item does not have member %s", pk)
+		if hierarchical {
+			charge, err := rc.createItem(ctx, databaseName, containerName, values, item)
+			if isConflict(err) {
+				return fmt.Errorf("importing item %d of %d into %v\\%v: item [%v] conflicts with an existing item, by id or by a unique key: %w", i+1, len(items), databaseName, containerName, item["id"], err)
+			}
+			if err != nil {
+				return err
+			}
+			ruSum = ruSum + charge
+			progress[checkpointKey] = i + 1
+			continue
 		}
-		val, ok := id.(string)
-		if !ok {
-			return fmt.Errorf("item member %s should be a string", pk)
+		pk, err := sdkPartitionKey(values[0])
+		if err != nil {
+			return fmt.Errorf("item %v: %w", item["id"], err)
 		}
-		pk := azcosmos.NewPartitionKeyString(val)
 		res, err := container.CreateItem(ctx, pk, b, nil)
+		if isConflict(err) {
+			return fmt.Errorf("importing item %d of %d into %v\\%v: %w", i+1, len(items), databaseName, containerName, explainConflict(ctx, container, pk, item, err))
+		}
 		if err != nil {
 			return err
 		}
 		ruSum = ruSum + float64(res.RequestCharge)
+		progress[checkpointKey] = i + 1
 	}
+	delete(progress, checkpointKey)
 
 	elapsed := time.Since(start)
 	log.Printf("Total RUs consumed: %f in %f seconds\n", ruSum, elapsed.Seconds())
@@ -1013,19 +1143,89 @@ func ImportData(client *azcosmos.Client, url1, pk, databaseName, containerName s
 	return nil
 }
 
-func UpdateSalesOrderQty(client *azcosmos.Client, databaseName, containerName, customerID string, salesOrder map[string]interface{}) error {
+// sampleSalesOrder returns the sales order menu options h and o create, and
+// the id of its customer.
+func sampleSalesOrder() (map[string]interface{}, string, error) {
+	// TODO: Autogenerate dates for orderDate and +7 days for shipping
+	b := `
+	{
+		"customerId": "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161",
+		"details": [
+			{
+				"name": "Road-550-W Yellow, 42",
+				"price": 1120.49,
+				"quantity": 1,
+				"sku": "BK-R64Y-42"
+			},
+			{
+				"name": "Sport-100 Helmet, Blue",
+				"price": 34.99,
+				"quantity": 1,
+				"sku": "HL-U509-B"
+			}
+		],
+		"id": "",
+		"orderDate": "2014-02-16T00:00:00",
+		"shipDate": "2014-02-23T00:00:00",
+		"type": "salesOrder"
+	}			
+	`
+
+	item := map[string]interface{}{}
+	err := json.Unmarshal([]byte(b), &item)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// get the customerID so we can update the
+	// customer's salesOrderQuantity
+	customerID := ""
+	if item, ok := item["customerId"]; ok {
+		if val, ok := item.(string); ok {
+			customerID = val
+		}
+	}
+
+	if customerID == "" {
+		return nil, "", errors.New("customerID is empty")
+	}
+
+	// create a new order from the above sample snippet
+
+	// We would have generated a new uuid using
+	// github.com/google/uuid as follows:
+	// orderID := uuid.New().String()
+	// Instead, we use a static orderID so we can delete later (option "i")
+	orderID := "8bdfc67f-2c68-40c5-9a36-2da649224c8b"
+	item["id"] = orderID
+	return item, customerID, nil
+}
+
+// orderOptions are how callers of UpdateSalesOrderQty and
+// DeleteCustomerOrderAndUpdateSalesOrderQty want the change made.
+type orderOptions struct {
+	// Quiet leaves out printing the customer and order, which the menu
+	// shows but the HTTP server would print for every request.
+	Quiet bool
+	// TTL, if set, is stored as the order's ttl so it expires that many
+	// seconds after it is written, or never for -1.
+	TTL *int32
+}
+
+func UpdateSalesOrderQty(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName, customerID string, salesOrder map[string]interface{}, opts orderOptions) error {
 	log.Printf("Creating a new Sales Order for customer %v in %v\\%v\n", customerID, databaseName, containerName)
 	partitionKey := azcosmos.NewPartitionKeyString(customerID)
+	if opts.TTL != nil {
+		salesOrder["ttl"] = *opts.TTL
+	}
 
 	container, err := client.NewContainer(databaseName, containerName)
 	if err != nil {
 		return err
 	}
 
-	itemResponse, err := container.ReadItem(context.Background(), partitionKey, customerID, nil)
+	itemResponse, err := container.ReadItem(ctx, partitionKey, customerID, nil)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
 		return err
 	}
 
@@ -1040,15 +1240,19 @@ func UpdateSalesOrderQty(client *azcosmos.Client, databaseName, containerName, c
 	if err != nil {
 		return err
 	}
-	log.Printf("Customer:\n")
-	fmt.Printf("%s\n", customerJSON)
+	if !opts.Quiet {
+		log.Printf("Customer:\n")
+		fmt.Printf("%s\n", customerJSON)
+	}
 
 	salesOrderJSON, err := json.MarshalIndent(salesOrder, "", "    ")
 	if err != nil {
 		return err
 	}
-	log.Printf("Sales Order:\n")
-	fmt.Printf("%s\n", salesOrderJSON)
+	if !opts.Quiet {
+		log.Printf("Sales Order:\n")
+		fmt.Printf("%s\n", salesOrderJSON)
+	}
 
 	salesOrderCount := 0.0
 	if val, ok := customer["salesOrderCount"]; ok {
@@ -1065,14 +1269,23 @@ func UpdateSalesOrderQty(client *azcosmos.Client, databaseName, containerName, c
 		return err
 	}
 
-	log.Printf("Customer:\n")
-	fmt.Printf("%s\n", customerJSON)
+	if !opts.Quiet {
+		log.Printf("Customer:\n")
+		fmt.Printf("%s\n", customerJSON)
+	}
 	customerID = customer["id"].(string)
 
+	ok, err := guard.allowWrite(fmt.Sprintf("create sales order and replace customer [%v] in %v\\%v", customerID, databaseName, containerName))
+	if !ok {
+		return err
+	}
+
 	batch := container.NewTransactionalBatch(partitionKey)
-	batch.UpsertItem(salesOrderJSON, nil)
-	batch.ReplaceItem(customerID, customerJSON, nil)
-	batchResponse, err := container.ExecuteTransactionalBatch(context.Background(), batch, nil)
+	// create, not upsert: reusing an order id must fail rather than replace
+	// the order and count it again
+	batch.CreateItem(salesOrderJSON, nil)
+	batch.ReplaceItem(customerID, customerJSON, &azcosmos.TransactionalBatchItemOptions{IfMatchETag: &itemResponse.ETag})
+	batchResponse, err := container.ExecuteTransactionalBatch(ctx, batch, nil)
 	if err != nil {
 		return err
 	}
@@ -1090,12 +1303,12 @@ func UpdateSalesOrderQty(client *azcosmos.Client, databaseName, containerName, c
 				log.Printf("Transaction failed due to operation %v which failed with status code %v", index, operation.StatusCode)
 			}
 		}
-		return errors.New("ExecuteTransactionalBatch failed")
+		return failedBatchError(batchResponse.OperationResults)
 	}
 	return nil
 }
 
-func DeleteCustomerOrderAndUpdateSalesOrderQty(client *azcosmos.Client, databaseName, containerName, orderID, customerID string) error {
+func DeleteCustomerOrderAndUpdateSalesOrderQty(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName, orderID, customerID string, opts orderOptions) error {
 	// TODO: We set a static orderID so we can delete later. We need to handle the transaction batch on error 404 if the
 	// orderID doesn't exist.
 
@@ -1107,10 +1320,8 @@ func DeleteCustomerOrderAndUpdateSalesOrderQty(client *azcosmos.Client, database
 		return err
 	}
 
-	itemResponse, err := container.ReadItem(context.Background(), partitionKey, customerID, nil)
+	itemResponse, err := container.ReadItem(ctx, partitionKey, customerID, nil)
 	if err != nil {
-		var responseErr *azcore.ResponseError
-		errors.As(err, &responseErr)
 		return err
 	}
 
@@ -1125,8 +1336,10 @@ func DeleteCustomerOrderAndUpdateSalesOrderQty(client *azcosmos.Client, database
 	if err != nil {
 		return err
 	}
-	log.Printf("Customer:\n")
-	fmt.Printf("%s\n", customerJSON)
+	if !opts.Quiet {
+		log.Printf("Customer:\n")
+		fmt.Printf("%s\n", customerJSON)
+	}
 
 	// Update the customer salesOrderCount
 	salesOrderCount := 0.0
@@ -1144,14 +1357,21 @@ func DeleteCustomerOrderAndUpdateSalesOrderQty(client *azcosmos.Client, database
 		return err
 	}
 
-	log.Printf("Customer:\n")
-	fmt.Printf("%s\n", customerJSON)
+	if !opts.Quiet {
+		log.Printf("Customer:\n")
+		fmt.Printf("%s\n", customerJSON)
+	}
 	customerID = customer["id"].(string)
 
+	ok, err := guard.allowWrite(fmt.Sprintf("delete sales order [%v] and replace customer [%v] in %v\\%v", orderID, customerID, databaseName, containerName))
+	if !ok {
+		return err
+	}
+
 	batch := container.NewTransactionalBatch(partitionKey)
 	batch.DeleteItem(orderID, nil)
-	batch.ReplaceItem(customerID, customerJSON, &azcosmos.TransactionalBatchItemOptions{})
-	batchResponse, err := container.ExecuteTransactionalBatch(context.Background(), batch, nil)
+	batch.ReplaceItem(customerID, customerJSON, &azcosmos.TransactionalBatchItemOptions{IfMatchETag: &itemResponse.ETag})
+	batchResponse, err := container.ExecuteTransactionalBatch(ctx, batch, nil)
 	if err != nil {
 		return err
 	}
@@ -1169,7 +1389,7 @@ func DeleteCustomerOrderAndUpdateSalesOrderQty(client *azcosmos.Client, database
 				log.Printf("Transaction failed due to operation %v which failed with status code %v", index, operation.StatusCode)
 			}
 		}
-		return errors.New("ExecuteTransactionalBatch failed")
+		return failedBatchError(batchResponse.OperationResults)
 	}
 	return nil
 }
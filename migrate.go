@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// transformFunc turns an item of one schema version into its shape in the
+// next. Returning a nil item drops it.
+type transformFunc func(item map[string]interface{}, m *migration) (map[string]interface{}, error)
+
+// migrationStep copies one source container into a target container of the
+// next schema version, transforming each item on the way. Prepare, if set,
+// runs before the copy to build lookups the transform needs.
+type migrationStep struct {
+	Source    string // "database-v3/customer"
+	Target    string // "database-v4/customer"
+	TargetPK  string // partition key path of the target, e.g. "/customerId"
+	Prepare   func(ctx context.Context, m *migration) error
+	Transform transformFunc
+}
+
+// migrationSteps holds the steps that move data from schema version n to
+// n+1, keyed by n. database-v1 isn't provisioned by this tool, so there is no
+// v1 to v2 migration.
+var migrationSteps = map[int][]migrationStep{
+	2: {
+		{Source: "database-v2/customer", Target: "database-v3/customer", TargetPK: "/id", Transform: copyItem},
+		{Source: "database-v2/salesOrder", Target: "database-v3/salesOrder", TargetPK: "/customerId", Transform: copyItem},
+		{Source: "database-v2/productCategory", Target: "database-v3/productCategory", TargetPK: "/type", Transform: withType("category")},
+		{Source: "database-v2/productTag", Target: "database-v3/productTag", TargetPK: "/type", Transform: withType("tag")},
+		{
+			Source:    "database-v2/product",
+			Target:    "database-v3/product",
+			TargetPK:  "/categoryId",
+			Prepare:   lookupCategoryNames("database-v2/productCategory"),
+			Transform: denormalizeCategoryName,
+		},
+	},
+	3: {
+		{
+			Source:    "database-v3/customer",
+			Target:    "database-v4/customer",
+			TargetPK:  "/customerId",
+			Prepare:   countSalesOrders("database-v3/salesOrder"),
+			Transform: embedCustomer,
+		},
+		{Source: "database-v3/salesOrder", Target: "database-v4/customer", TargetPK: "/customerId", Transform: withType("salesOrder")},
+		{Source: "database-v3/product", Target: "database-v4/product", TargetPK: "/categoryId", Transform: copyItem},
+		{Source: "database-v3/productCategory", Target: "database-v4/productMeta", TargetPK: "/type", Transform: withType("category")},
+		{Source: "database-v3/productTag", Target: "database-v4/productMeta", TargetPK: "/type", Transform: withType("tag")},
+	},
+}
+
+// migration is the state shared by the steps of a run.
+type migration struct {
+	rc     *restClient
+	client *azcosmos.Client
+	dryRun bool
+	// provisioning is the throughput given to target databases and
+	// containers that don't exist yet.
+	provisioning provisioning
+	// lookups are built by Prepare functions, e.g. lookups["categoryName"]
+	// maps a category id to its name.
+	lookups map[string]map[string]interface{}
+}
+
+func splitContainerPath(p string) (databaseName, containerName string) {
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) != 2 {
+		return p, ""
+	}
+	return parts[0], parts[1]
+}
+
+// systemProperties are set by the service and must not be copied.
+var systemProperties = []string{"_rid", "_self", "_etag", "_attachments", "_ts"}
+
+func copyItem(item map[string]interface{}, m *migration) (map[string]interface{}, error) {
+	return item, nil
+}
+
+// withType sets the "type" discriminator used once several entity types
+// share a container.
+func withType(typ string) transformFunc {
+	return func(item map[string]interface{}, m *migration) (map[string]interface{}, error) {
+		item["type"] = typ
+		return item, nil
+	}
+}
+
+// categoryValue returns a category's name. The sample code keeps it in
+// "value", the imported data in "name".
+func categoryValue(category map[string]interface{}) (string, bool) {
+	if v, ok := category["value"].(string); ok {
+		return v, true
+	}
+	v, ok := category["name"].(string)
+	return v, ok
+}
+
+func lookupCategoryNames(source string) func(ctx context.Context, m *migration) error {
+	return func(ctx context.Context, m *migration) error {
+		names := map[string]interface{}{}
+		databaseName, containerName := splitContainerPath(source)
+		err := m.rc.readItems(ctx, databaseName, containerName, func(raw json.RawMessage) error {
+			category := map[string]interface{}{}
+			if err := json.Unmarshal(raw, &category); err != nil {
+				return err
+			}
+			id, _ := category["id"].(string)
+			names[id], _ = categoryValue(category)
+			return nil
+		})
+		m.lookups["categoryName"] = names
+		return err
+	}
+}
+
+func denormalizeCategoryName(item map[string]interface{}, m *migration) (map[string]interface{}, error) {
+	categoryID, _ := item["categoryId"].(string)
+	name, ok := m.lookups["categoryName"][categoryID]
+	if !ok {
+		return nil, fmt.Errorf("product %v: category %q not found", item["id"], categoryID)
+	}
+	item["categoryName"] = name
+	return item, nil
+}
+
+func countSalesOrders(source string) func(ctx context.Context, m *migration) error {
+	return func(ctx context.Context, m *migration) error {
+		counts := map[string]interface{}{}
+		databaseName, containerName := splitContainerPath(source)
+		err := m.rc.readItems(ctx, databaseName, containerName, func(raw json.RawMessage) error {
+			order := struct {
+				CustomerID string `json:"customerId"`
+			}{}
+			if err := json.Unmarshal(raw, &order); err != nil {
+				return err
+			}
+			n, _ := counts[order.CustomerID].(float64)
+			counts[order.CustomerID] = n + 1
+			return nil
+		})
+		if isNotFound(err) {
+			log.Printf("No %v to count orders from, salesOrderCount will be 0\n", source)
+			err = nil
+		}
+		m.lookups["salesOrderCount"] = counts
+		return err
+	}
+}
+
+// embedCustomer shapes a customer for the v4 customer container, where it is
+// stored alongside its orders: partitioned by customerId, tagged with a type
+// and carrying the number of orders.
+func embedCustomer(item map[string]interface{}, m *migration) (map[string]interface{}, error) {
+	item["type"] = "customer"
+	item["customerId"] = item["id"]
+	count, _ := m.lookups["salesOrderCount"][fmt.Sprint(item["id"])].(float64)
+	item["salesOrderCount"] = count
+	return item, nil
+}
+
+// prepare checks the source of step is there and builds the lookups its
+// transform needs.
+func (m *migration) prepare(ctx context.Context, step migrationStep) error {
+	sourceDatabase, sourceContainer := splitContainerPath(step.Source)
+	if _, err := m.rc.countItems(ctx, sourceDatabase, sourceContainer); err != nil {
+		return err
+	}
+	if step.Prepare != nil {
+		return step.Prepare(ctx, m)
+	}
+	return nil
+}
+
+// eachItem reads the source of step and passes each item, transformed into
+// its target shape, to fn along with its partition key value.
+func (m *migration) eachItem(ctx context.Context, step migrationStep, fn func(item map[string]interface{}, pkValue string) error) error {
+	sourceDatabase, sourceContainer := splitContainerPath(step.Source)
+	pkField := strings.TrimPrefix(step.TargetPK, "/")
+	return m.rc.readItems(ctx, sourceDatabase, sourceContainer, func(raw json.RawMessage) error {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		for _, name := range systemProperties {
+			delete(item, name)
+		}
+
+		item, err := step.Transform(item, m)
+		if err != nil || item == nil {
+			return err
+		}
+
+		pkValue, ok := item[pkField].(string)
+		if !ok {
+			return fmt.Errorf("item %v has no string %s for partition key %s", item["id"], pkField, step.TargetPK)
+		}
+		return fn(item, pkValue)
+	})
+}
+
+// checkUniqueKeys is the pre-flight check for targets that exist and have
+// unique keys: it combines what is already there with what the steps would
+// upsert, and fails listing the items that would break a unique key, before
+// anything is written.
+func (m *migration) checkUniqueKeys(ctx context.Context, steps []migrationStep) error {
+	var targets []string
+	seen := map[string]bool{}
+	for _, step := range steps {
+		if !seen[step.Target] {
+			seen[step.Target] = true
+			targets = append(targets, step.Target)
+		}
+	}
+
+	for _, target := range targets {
+		targetDatabase, targetContainer := splitContainerPath(target)
+		_, properties, err := readContainerProperties(ctx, m.client, targetDatabase, targetContainer)
+		if isNotFound(err) {
+			// created by the migration, without unique keys
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if properties.UniqueKeyPolicy == nil || len(properties.UniqueKeyPolicy.UniqueKeys) == 0 || len(properties.PartitionKeyDefinition.Paths) == 0 {
+			continue
+		}
+
+		log.Printf("Checking %v against its unique keys %v\n", target, formatUniqueKeys(properties.UniqueKeyPolicy))
+		checker := newUniqueKeyChecker(*properties.UniqueKeyPolicy, properties.PartitionKeyDefinition.Paths)
+		err = m.rc.readItems(ctx, targetDatabase, targetContainer, func(raw json.RawMessage) error {
+			item := map[string]interface{}{}
+			if err := json.Unmarshal(raw, &item); err != nil {
+				return err
+			}
+			checker.add(item)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, step := range steps {
+			if step.Target != target {
+				continue
+			}
+			err := m.prepare(ctx, step)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = m.eachItem(ctx, step, func(item map[string]interface{}, pkValue string) error {
+				checker.add(item)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		duplicates := checker.duplicates()
+		if len(duplicates) == 0 {
+			continue
+		}
+		const shown = 20
+		for i, d := range duplicates {
+			if i == shown {
+				fmt.Printf("  ... and %d more\n", len(duplicates)-shown)
+				break
+			}
+			fmt.Printf("  %v\n", d)
+		}
+		return fmt.Errorf("migrating into %v would violate its unique keys %v in %d places, listed above; a missing value counts as null, so only one item per partition may lack a key", target, formatUniqueKeys(properties.UniqueKeyPolicy), len(duplicates))
+	}
+	return nil
+}
+
+// run executes one step into schema version, returning the number of items
+// written.
+func (m *migration) run(ctx context.Context, version int, step migrationStep) (int, error) {
+	targetDatabase, targetContainer := splitContainerPath(step.Target)
+
+	// check the source is there before creating anything for it
+	if err := m.prepare(ctx, step); err != nil {
+		return 0, err
+	}
+
+	var container *azcosmos.ContainerClient
+	if !m.dryRun {
+		if err := CreateDatabaseAndContainers(ctx, m.client, targetDatabase, version, m.provisioning); err != nil {
+			return 0, err
+		}
+		if err := createContainer(ctx, m.client, targetDatabase, targetContainer, step.TargetPK, m.provisioning, containerPolicy{}); err != nil {
+			return 0, err
+		}
+		c, err := m.client.NewContainer(targetDatabase, targetContainer)
+		if err != nil {
+			return 0, err
+		}
+		container = c
+	}
+
+	n := 0
+	ruSum := 0.0
+	err := m.eachItem(ctx, step, func(item map[string]interface{}, pkValue string) error {
+		n++
+		if m.dryRun {
+			return nil
+		}
+
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		res, err := container.UpsertItem(ctx, azcosmos.NewPartitionKeyString(pkValue), b, nil)
+		if isConflict(err) {
+			return uniqueKeyConflict(ctx, container, item, err)
+		}
+		if err != nil {
+			return err
+		}
+		ruSum += float64(res.RequestCharge)
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+
+	log.Printf("Consumed %f RU writing %v\n", ruSum, step.Target)
+	return n, nil
+}
+
+// migrate moves data forward from schema version from to version to, one
+// version at a time. Items are upserted, so a migration can be re-run after
+// an interruption.
+func migrate(ctx context.Context, m *migration, from, to int) error {
+	if from >= to {
+		return fmt.Errorf("cannot migrate from v%d to v%d: only forward migrations are supported", from, to)
+	}
+
+	for version := from; version < to; version++ {
+		steps, ok := migrationSteps[version]
+		if !ok {
+			return fmt.Errorf("no migration from v%d to v%d", version, version+1)
+		}
+
+		fmt.Printf("Migrating %s to %s\n", schemaDatabaseName(version), schemaDatabaseName(version+1))
+		if err := m.checkUniqueKeys(ctx, steps); err != nil {
+			return err
+		}
+		for _, step := range steps {
+			start := time.Now()
+			n, err := m.run(ctx, version+1, step)
+			if isNotFound(err) {
+				log.Printf("Skipping %v: not found\n", step.Source)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("migrate %v to %v: %w", step.Source, step.Target, err)
+			}
+
+			verb := "Copied"
+			if m.dryRun {
+				verb = "[dry-run] would copy"
+			}
+			fmt.Printf("%s %d items from %v to %v in %f seconds\n", verb, n, step.Source, step.Target, time.Since(start).Seconds())
+		}
+	}
+	return nil
+}
+
+// runMigrateCommand implements `migrate [-from n] [-to n]`.
+func runMigrateCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.Int("from", 3, "schema version to migrate from")
+	to := fs.Int("to", 4, "schema version to migrate to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: migrate [-from n] [-to n]")
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	if !opts.DryRun {
+		if err := newSafety(opts, p, rc).checkProtected(fmt.Sprintf("migrate into %s", schemaDatabaseName(*to))); err != nil {
+			return err
+		}
+	}
+
+	m := &migration{
+		rc:           rc,
+		client:       client,
+		dryRun:       opts.DryRun,
+		provisioning: p.provisioning(),
+		lookups:      map[string]map[string]interface{}{},
+	}
+	return migrate(ctx, m, *from, *to)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// queryPage is one page of a query's results. Continuation resumes the query
+// after it and is empty on the last page.
+type queryPage struct {
+	Items         []map[string]interface{}
+	Continuation  string
+	RequestCharge float32
+	// IndexMetrics is the raw index utilization header, see
+	// decodeIndexMetrics.
+	IndexMetrics string
+	// QueryMetrics is the raw query metrics header, see parseQueryMetrics.
+	QueryMetrics string
+}
+
+// queryItemsPage runs a single-partition query and returns one page of
+// results, starting after continuation if given. pageSize is a hint: the
+// service may return fewer items, or even none, on a page that isn't the
+// last.
+func queryItemsPage(ctx context.Context, client *azcosmos.Client, databaseName, containerName, query, partitionKey string, pageSize int32, continuation string) (queryPage, error) {
+	return queryItemsPageByKey(ctx, client, databaseName, containerName, query, azcosmos.NewPartitionKeyString(partitionKey), pageSize, continuation)
+}
+
+// queryItemsPageByKey is queryItemsPage for a partition key of any type.
+func queryItemsPageByKey(ctx context.Context, client *azcosmos.Client, databaseName, containerName, query string, pk azcosmos.PartitionKey, pageSize int32, continuation string) (queryPage, error) {
+	container, err := client.NewContainer(databaseName, containerName)
+	if err != nil {
+		return queryPage{}, err
+	}
+
+	options := &azcosmos.QueryOptions{
+		PopulateIndexMetrics: true,
+		PageSizeHint:         pageSize,
+		ContinuationToken:    continuation,
+	}
+	queryPager := container.NewQueryItemsPager(query, pk, options)
+	queryResponse, err := queryPager.NextPage(ctx)
+	if err != nil {
+		return queryPage{}, err
+	}
+
+	page := queryPage{
+		Items:         make([]map[string]interface{}, 0, len(queryResponse.Items)),
+		Continuation:  queryResponse.ContinuationToken,
+		RequestCharge: queryResponse.RequestCharge,
+	}
+	if queryResponse.IndexMetrics != nil {
+		page.IndexMetrics = *queryResponse.IndexMetrics
+	}
+	if queryResponse.QueryMetrics != nil {
+		page.QueryMetrics = *queryResponse.QueryMetrics
+	}
+	for _, item := range queryResponse.Items {
+		map1 := map[string]interface{}{}
+		err := json.Unmarshal(item, &map1)
+		if err != nil {
+			return queryPage{}, err
+		}
+		page.Items = append(page.Items, map1)
+	}
+	log.Printf("Query page received with %d items. Status %d. ActivityId %s. Consuming %v RU\n", len(queryResponse.Items), queryResponse.RawResponse.StatusCode, queryResponse.ActivityID, queryResponse.RequestCharge)
+	return page, nil
+}
+
+// cursor is what the HTTP server hands out in place of a raw continuation
+// token. It records the partition the token belongs to, so a cursor from one
+// customer's orders can't be replayed against another's.
+type cursor struct {
+	PartitionKey string `json:"pk"`
+	Continuation string `json:"c"`
+}
+
+func encodeCursor(partitionKey, continuation string) string {
+	if continuation == "" {
+		return ""
+	}
+	b, _ := json.Marshal(cursor{PartitionKey: partitionKey, Continuation: continuation})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the continuation token in s, checking it was issued
+// for partitionKey. An empty s starts from the beginning.
+func decodeCursor(s, partitionKey string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", badRequest("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.PartitionKey != partitionKey {
+		return "", badRequest("invalid cursor")
+	}
+	return c.Continuation, nil
+}
+
+// runQueryCommand implements
+// `query [-database name] [-container name] -pk value [-page-size n] [-continuation token] [-all] [-index-metrics] [-query-metrics] <sql>`.
+func runQueryCommand(ctx context.Context, opts globalOptions, args []string) error {
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database to query")
+	containerName := fs.String("container", p.container("customer"), "container to query")
+	pk := fs.String("pk", "", "partition key value to query")
+	pageSize := fs.Int("page-size", 25, "items per page, a hint the service may return fewer than")
+	continuation := fs.String("continuation", "", "continuation token printed by a previous page")
+	all := fs.Bool("all", false, "fetch every page instead of stopping after one")
+	showIndexMetrics := fs.Bool("index-metrics", false, "show the indexes each page used and the ones it could have used")
+	showQueryMetrics := fs.Bool("query-metrics", opts.QueryMetrics, "show execution metrics for each page, and totals across pages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *pk == "" {
+		return errors.New(`usage: query [-database name] [-container name] -pk value [-page-size n] [-continuation token] [-all] [-index-metrics] [-query-metrics] "SELECT ..."`)
+	}
+	if *pageSize < 1 {
+		return fmt.Errorf("page size must be at least 1, got %d", *pageSize)
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	token := *continuation
+	var total queryMetrics
+	for {
+		page, err := queryItemsPage(ctx, client, *databaseName, *containerName, fs.Arg(0), *pk, int32(*pageSize), token)
+		if err != nil {
+			return err
+		}
+		if err := printItems(page.Items); err != nil {
+			return err
+		}
+		if *showIndexMetrics && page.IndexMetrics != "" {
+			m, err := decodeIndexMetrics(page.IndexMetrics)
+			if err != nil {
+				return err
+			}
+			printIndexMetrics(os.Stdout, m)
+		}
+		if *showQueryMetrics && page.QueryMetrics != "" {
+			m, err := parseQueryMetrics(page.QueryMetrics)
+			if err != nil {
+				return err
+			}
+			m.RequestCharge = float64(page.RequestCharge)
+			printQueryMetrics(os.Stdout, "Query metrics for this page", m)
+			total.add(m)
+		}
+		token = page.Continuation
+		if token == "" || !*all {
+			break
+		}
+	}
+
+	if total.Pages > 1 {
+		printQueryMetrics(os.Stdout, "Query metrics for all pages", total)
+	}
+	if token != "" {
+		log.Printf("More results available, continue with: -continuation '%s'\n", token)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		partitionKey string
+		continuation string
+	}{
+		{name: "token", partitionKey: "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161", continuation: `{"token":"-RID:~abc==#RT:1#TRC:10","range":{"min":"","max":"FF"}}`},
+		{name: "category", partitionKey: "category", continuation: "+RID:~xyz#RT:2"},
+		{name: "empty partition key", partitionKey: "", continuation: "t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := encodeCursor(tt.partitionKey, tt.continuation)
+			got, err := decodeCursor(s, tt.partitionKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.continuation {
+				t.Errorf("decodeCursor(encodeCursor(%q)) = %q", tt.continuation, got)
+			}
+		})
+	}
+}
+
+func TestCursorLastPage(t *testing.T) {
+	if s := encodeCursor("c1", ""); s != "" {
+		t.Errorf("encodeCursor with no continuation = %q, want no cursor", s)
+	}
+	got, err := decodeCursor("", "c1")
+	if err != nil || got != "" {
+		t.Errorf(`decodeCursor("") = %q, %v, want the first page`, got, err)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	fromC1 := encodeCursor("c1", "token")
+	tests := []struct {
+		name         string
+		cursor       string
+		partitionKey string
+	}{
+		{name: "another partition key", cursor: fromC1, partitionKey: "c2"},
+		{name: "partition key prefix", cursor: encodeCursor("c", "token"), partitionKey: "c1"},
+		{name: "bad base64", cursor: "not base64!", partitionKey: "c1"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"pk":"c1","c":"token"}`)), partitionKey: "c1"},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("token")), partitionKey: "c1"},
+		{name: "raw continuation token", cursor: "+RID:~abc#RT:1", partitionKey: "c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor, tt.partitionKey)
+			var he *httpError
+			if !errors.As(err, &he) || he.status != http.StatusBadRequest {
+				t.Fatalf("decodeCursor = %q, %v, want a 400", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Hierarchical partition keys split a container by up to three paths, e.g.
+// /customerId then /type, so one customer's data can outgrow a single
+// logical partition while queries for a customer still go to few physical
+// partitions. The SDK version we build against only knows single-value keys:
+// azcosmos.PartitionKey holds one value and PartitionKeyDefinition has no
+// kind. Until it catches up, hierarchical containers are created, written,
+// read and queried through the REST client, and transactional batches, which
+// only the SDK sends, can't be used with them.
+
+// maxPartitionKeyLevels is how many paths a hierarchical key may have.
+const maxPartitionKeyLevels = 3
+
+// subPartitionFlag adds a flag taking the comma separated paths that
+// partition new containers further under their own key, e.g. /type. The
+// returned function gives the paths once fs is parsed.
+func subPartitionFlag(fs *flag.FlagSet, name, usage string) func() []string {
+	var paths []string
+	fs.Func(name, usage, func(s string) error {
+		paths = nil
+		for _, path := range strings.Split(s, ",") {
+			path = strings.TrimSpace(path)
+			if !strings.HasPrefix(path, "/") || path == "/" {
+				return fmt.Errorf("bad partition key path %q, paths look like /type or /address/city", path)
+			}
+			paths = append(paths, path)
+		}
+		// the container's own key is the first level
+		if 1+len(paths) > maxPartitionKeyLevels {
+			return fmt.Errorf("a partition key has at most %d paths, so at most %d can be added, got %v", maxPartitionKeyLevels, maxPartitionKeyLevels-1, paths)
+		}
+		return nil
+	})
+	return func() []string { return paths }
+}
+
+// hierarchicalPaths is the key of a container partitioned by partitionKey
+// and then by sub. The service refuses a key that names a path twice, so
+// that is an error here, before anything is created.
+func hierarchicalPaths(partitionKey string, sub []string) ([]string, error) {
+	paths := []string{partitionKey}
+	for _, path := range sub {
+		for _, p := range paths {
+			if p == path {
+				return nil, fmt.Errorf("can't partition by %s under %s, it is already part of the key", path, strings.Join(paths, " + "))
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// checkSubPartitions checks that sub can partition every sample container the
+// selectors pick that doesn't exist yet. A path can clash with the key of
+// some containers only, so they are all checked before any is created.
+func checkSubPartitions(inv inventory, selectors []selector, sub []string) error {
+	if len(sub) == 0 {
+		return nil
+	}
+	for _, c := range sampleContainers {
+		if !selectsContainer(selectors, c.Database, c.Container) || inv.hasContainer(c.Database, c.Container) {
+			continue
+		}
+		if _, err := hierarchicalPaths("/"+c.PK, sub); err != nil {
+			return fmt.Errorf("container %v\\%v: %w; select only the containers to partition further", c.Database, c.Container, err)
+		}
+	}
+	return nil
+}
+
+// partitionKeyDefinition is the container's partition key as the service
+// describes it, including the kind the SDK leaves out.
+type partitionKeyDefinition struct {
+	Paths   []string `json:"paths"`
+	Kind    string   `json:"kind,omitempty"`
+	Version int      `json:"version,omitempty"`
+}
+
+func (d partitionKeyDefinition) hierarchical() bool {
+	return len(d.Paths) > 1
+}
+
+func (d partitionKeyDefinition) String() string {
+	if d.hierarchical() {
+		return strings.Join(d.Paths, " + ") + " (hierarchical)"
+	}
+	return strings.Join(d.Paths, "")
+}
+
+// partitionKeyValues returns the values of item at each of paths, the
+// partition key of the item in a container partitioned by them. A missing
+// member is an error rather than null, which the service would accept but
+// is rarely what was meant.
+func partitionKeyValues(item map[string]interface{}, paths []string) ([]interface{}, error) {
+	values := make([]interface{}, len(paths))
+	for i, path := range paths {
+		value, ok := valueAtPath(item, path)
+		if !ok {
+			return nil, fmt.Errorf("item %v has no %s for the partition key", item["id"], path)
+		}
+		switch value.(type) {
+		case string, float64, bool, nil:
+		default:
+			return nil, fmt.Errorf("item %v: %s is not a string, number or boolean, so can't be a partition key", item["id"], path)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// sdkPartitionKey is the SDK's partition key for a single-path key value.
+func sdkPartitionKey(value interface{}) (azcosmos.PartitionKey, error) {
+	switch v := value.(type) {
+	case string:
+		return azcosmos.NewPartitionKeyString(v), nil
+	case float64:
+		return azcosmos.NewPartitionKeyNumber(v), nil
+	case bool:
+		return azcosmos.NewPartitionKeyBool(v), nil
+	}
+	return azcosmos.PartitionKey{}, fmt.Errorf("partition key value %v can't be sent through the SDK", value)
+}
+
+// syntheticKey is a partition key member built from other members of an
+// item, for containers that no single member partitions well: /partitionKey
+// from /customerId and /type holds e.g. "0012D555-...-salesOrder".
+type syntheticKey struct {
+	Path    string
+	Sources []string
+}
+
+const syntheticKeySeparator = "-"
+
+// apply sets the synthetic key of item from its sources. A missing source
+// is an error, since the key would silently differ from its siblings', and
+// so is an item that already has another value at the key's path, which
+// would be lost. The same value, as in data exported after an earlier
+// import, is left as it is.
+func (k syntheticKey) apply(item map[string]interface{}) error {
+	parts := make([]string, len(k.Sources))
+	for i, path := range k.Sources {
+		value, ok := valueAtPath(item, path)
+		if !ok {
+			return fmt.Errorf("item %v has no %s for the synthetic key %s", item["id"], path, k.Path)
+		}
+		switch v := value.(type) {
+		case string:
+			parts[i] = v
+		case float64, bool:
+			b, _ := json.Marshal(v)
+			parts[i] = string(b)
+		default:
+			return fmt.Errorf("item %v: %s is not a string, number or boolean, so can't be part of the synthetic key %s", item["id"], path, k.Path)
+		}
+	}
+	key := strings.Join(parts, syntheticKeySeparator)
+	if existing, ok := valueAtPath(item, k.Path); ok && existing != key {
+		return fmt.Errorf("item %v already has %s = %v, which the synthetic key would replace with %q", item["id"], k.Path, existing, key)
+	}
+	return setValueAtPath(item, k.Path, key)
+}
+
+// setValueAtPath sets the member of item at a path such as /address/country,
+// adding the objects on the way that are missing.
+func setValueAtPath(item map[string]interface{}, path string, value interface{}) error {
+	names := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	m := item
+	for _, name := range names[:len(names)-1] {
+		next, ok := m[name]
+		if !ok {
+			next = map[string]interface{}{}
+			m[name] = next
+		}
+		if m, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("item %v: can't set %s, /%s is not an object", item["id"], path, name)
+		}
+	}
+	m[names[len(names)-1]] = value
+	return nil
+}
+
+// syntheticKeyFlag adds a repeatable flag taking a synthetic key as the path
+// to set and the comma separated paths it is built from, e.g.
+// -synthetic /partitionKey=/customerId,/type.
+func syntheticKeyFlag(fs *flag.FlagSet, name, usage string) func() []syntheticKey {
+	var keys []syntheticKey
+	fs.Func(name, usage, func(s string) error {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return fmt.Errorf("bad synthetic key %q, it looks like /partitionKey=/customerId,/type", s)
+		}
+		var paths []string
+		for _, path := range append([]string{s[:i]}, strings.Split(s[i+1:], ",")...) {
+			path = strings.TrimSpace(path)
+			if !strings.HasPrefix(path, "/") || path == "/" {
+				return fmt.Errorf("bad synthetic key path %q, paths look like /type or /address/country", path)
+			}
+			paths = append(paths, path)
+		}
+		keys = append(keys, syntheticKey{Path: paths[0], Sources: paths[1:]})
+		return nil
+	})
+	return func() []syntheticKey { return keys }
+}
+
+func partitionKeyHeader(values []interface{}) (map[string]string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"x-ms-documentdb-partitionkey": string(b)}, nil
+}
+
+// sqlPath turns a path such as /address/country into c["address"]["country"].
+func sqlPath(path string) string {
+	var b strings.Builder
+	b.WriteString("c")
+	for _, name := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		b.WriteString("[" + strconv.Quote(name) + "]")
+	}
+	return b.String()
+}
+
+// createHierarchicalContainer creates a container partitioned by several
+// paths. createContainer can't, since the SDK can't describe the key.
+func createHierarchicalContainer(ctx context.Context, rc *restClient, databaseName, containerName string, paths []string, prov provisioning, policy containerPolicy) error {
+	log.Printf("\nCreating container [%v] in database [%v] partitioned by %v\n", containerName, databaseName, strings.Join(paths, " + "))
+	if len(paths) > maxPartitionKeyLevels {
+		return fmt.Errorf("a partition key has at most %d paths, got %v", maxPartitionKeyLevels, paths)
+	}
+
+	body := struct {
+		ID              string                    `json:"id"`
+		PartitionKey    partitionKeyDefinition    `json:"partitionKey"`
+		DefaultTTL      *int32                    `json:"defaultTtl,omitempty"`
+		UniqueKeyPolicy *azcosmos.UniqueKeyPolicy `json:"uniqueKeyPolicy,omitempty"`
+	}{
+		ID:              containerName,
+		PartitionKey:    partitionKeyDefinition{Paths: paths, Kind: "MultiHash", Version: 2},
+		DefaultTTL:      policy.DefaultTTL,
+		UniqueKeyPolicy: uniqueKeyPolicy(policy.UniqueKeys),
+	}
+	headers := map[string]string{}
+	if !prov.Shared {
+		if prov.Autoscale {
+			headers["x-ms-cosmos-offer-autopilot-settings"] = fmt.Sprintf(`{"maxThroughput":%d}`, prov.Throughput)
+		} else {
+			headers["x-ms-offer-throughput"] = strconv.Itoa(int(prov.Throughput))
+		}
+	}
+
+	link := "dbs/" + databaseName
+	resp, err := rc.do(ctx, http.MethodPost, "/"+link+"/colls", restResource{resourceType: "colls", resourceLink: link}, headers, body, nil)
+	if isConflict(err) {
+		log.Printf("Container [%v] already exists\n", containerName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Container [%v] created. ActivityId %s\n", containerName, resp.Header.Get("x-ms-activity-id"))
+	return nil
+}
+
+func (c *restClient) readContainer(ctx context.Context, databaseName, containerName string) (containerInfo, error) {
+	var info containerInfo
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	err := c.get(ctx, "/"+link, restResource{resourceType: "colls", resourceLink: link}, &info)
+	return info, err
+}
+
+// createItem creates item in the logical partition pk, which may have a
+// value for each level of a hierarchical key. It returns the request charge.
+func (c *restClient) createItem(ctx context.Context, databaseName, containerName string, pk []interface{}, item map[string]interface{}) (float64, error) {
+	headers, err := partitionKeyHeader(pk)
+	if err != nil {
+		return 0, err
+	}
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	resp, err := c.do(ctx, http.MethodPost, "/"+link+"/docs", restResource{resourceType: "docs", resourceLink: link}, headers, item, nil)
+	if err != nil {
+		return 0, err
+	}
+	charge, _ := strconv.ParseFloat(resp.Header.Get("x-ms-request-charge"), 64)
+	return charge, nil
+}
+
+// readItem is a point read by id in the logical partition pk.
+func (c *restClient) readItem(ctx context.Context, databaseName, containerName string, pk []interface{}, id string) (map[string]interface{}, error) {
+	headers, err := partitionKeyHeader(pk)
+	if err != nil {
+		return nil, err
+	}
+	link := "dbs/" + databaseName + "/colls/" + containerName + "/docs/" + id
+	item := map[string]interface{}{}
+	_, err = c.do(ctx, http.MethodGet, "/"+link, restResource{resourceType: "docs", resourceLink: link}, headers, nil, &item)
+	return item, err
+}
+
+// queryPartitionPrefix passes fn every item whose partition key starts with
+// prefix. A complete key is queried in its single logical partition; a
+// prefix, such as only the customerId of /customerId + /type, spans several
+// and is sent as a cross-partition query filtering on the prefix, which the
+// service routes to the physical partitions holding it.
+func (c *restClient) queryPartitionPrefix(ctx context.Context, databaseName, containerName string, definition partitionKeyDefinition, prefix []interface{}, fn func(item map[string]interface{}) error) error {
+	if len(prefix) == 0 || len(prefix) > len(definition.Paths) {
+		return fmt.Errorf("partition key %v takes 1 to %d values, got %d", definition, len(definition.Paths), len(prefix))
+	}
+
+	type parameter struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	query := struct {
+		Query      string      `json:"query"`
+		Parameters []parameter `json:"parameters"`
+	}{}
+	var filters []string
+	for i, value := range prefix {
+		name := fmt.Sprintf("@pk%d", i)
+		filters = append(filters, sqlPath(definition.Paths[i])+" = "+name)
+		query.Parameters = append(query.Parameters, parameter{Name: name, Value: value})
+	}
+	query.Query = "SELECT * FROM c WHERE " + strings.Join(filters, " AND ")
+
+	headers := map[string]string{
+		"x-ms-documentdb-isquery": "True",
+		"Content-Type":            "application/query+json",
+	}
+	if len(prefix) == len(definition.Paths) {
+		pk, err := partitionKeyHeader(prefix)
+		if err != nil {
+			return err
+		}
+		for k, v := range pk {
+			headers[k] = v
+		}
+	} else {
+		headers["x-ms-documentdb-query-enablecrosspartition"] = "True"
+	}
+
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	for {
+		resp, err := c.do(ctx, http.MethodPost, "/"+link+"/docs", restResource{resourceType: "docs", resourceLink: link}, headers, query, nil)
+		if err != nil {
+			return err
+		}
+		page, err := runtime.Payload(resp)
+		if err != nil {
+			return err
+		}
+		feed := struct {
+			Documents []map[string]interface{} `json:"Documents"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		for _, item := range feed.Documents {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		continuation := resp.Header.Get("x-ms-continuation")
+		if continuation == "" {
+			return nil
+		}
+		headers["x-ms-continuation"] = continuation
+	}
+}
+
+// partitionKeyInput reads a partition key value typed by the user: JSON for a
+// number, boolean or quoted string, anything else as it is.
+func partitionKeyInput(s string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err == nil {
+		switch value.(type) {
+		case string, float64, bool:
+			return value
+		}
+	}
+	return s
+}
+
+// partitionKeyFlag adds a repeatable flag taking one partition key value,
+// given once per level of a hierarchical key. Values are read as
+// partitionKeyInput does, so 2024 is a number and "2024" a string.
+func partitionKeyFlag(fs *flag.FlagSet, name, usage string) func() []interface{} {
+	var values []interface{}
+	fs.Func(name, usage, func(s string) error {
+		values = append(values, partitionKeyInput(s))
+		return nil
+	})
+	return func() []interface{} { return values }
+}
+
+// runPartitionCommand implements `partition show`, `partition read -pk
+// value... id` and `partition items -pk value...` for one container, through
+// the REST client so hierarchical keys work.
+func runPartitionCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: partition [-database name] [-container name] show | read -pk value [-pk value...] id | items -pk value [-pk value...]"
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("partition", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database of the container")
+	containerName := fs.String("container", p.container("customer"), "container to look into")
+	pkValues := partitionKeyFlag(fs, "pk", "partition key value, a number or boolean as JSON, or quoted to keep it a string; repeat for each level of a hierarchical key, in order")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// flags may also follow the subcommand, as in `partition items -pk 1`
+	sub := fs.Args()
+	if len(sub) == 0 {
+		return errors.New(usage)
+	}
+	if err := fs.Parse(sub[1:]); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	info, err := rc.readContainer(ctx, *databaseName, *containerName)
+	if err != nil {
+		return err
+	}
+
+	switch sub[0] {
+	case "show":
+		if len(rest) > 0 {
+			return errors.New(usage)
+		}
+		fmt.Printf("Partition key of %v\\%v: %v\n", *databaseName, *containerName, info.PartitionKey)
+		return nil
+
+	case "read":
+		if len(rest) != 1 || len(pkValues()) != len(info.PartitionKey.Paths) {
+			return fmt.Errorf("%s\nread needs a -pk for each of %v", usage, info.PartitionKey)
+		}
+		item, err := rc.readItem(ctx, *databaseName, *containerName, pkValues(), rest[0])
+		if err != nil {
+			return err
+		}
+		return printItems([]map[string]interface{}{item})
+
+	case "items":
+		if len(rest) > 0 {
+			return errors.New(usage)
+		}
+		n := 0
+		err := rc.queryPartitionPrefix(ctx, *databaseName, *containerName, info.PartitionKey, pkValues(), func(item map[string]interface{}) error {
+			n++
+			return printItems([]map[string]interface{}{item})
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("%d items under %v = %v\n", n, info.PartitionKey, pkValues())
+		return nil
+	}
+	return errors.New(usage)
+}
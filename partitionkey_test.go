@@ -0,0 +1,329 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubPartitionFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{args: nil, want: nil},
+		{args: []string{"-subpartition", "/type"}, want: []string{"/type"}},
+		{args: []string{"-subpartition", "/type, /address/city"}, want: []string{"/type", "/address/city"}},
+		{args: []string{"-subpartition", "type"}, wantErr: true},
+		{args: []string{"-subpartition", "/"}, wantErr: true},
+		{args: []string{"-subpartition", "/type,"}, wantErr: true},
+		{args: []string{"-subpartition", "/a,/b,/c"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		paths := subPartitionFlag(fs, "subpartition", "")
+		err := fs.Parse(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: want an error, got %v", tt.args, paths())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if got := paths(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHierarchicalPaths(t *testing.T) {
+	tests := []struct {
+		partitionKey string
+		sub          []string
+		want         []string
+		wantErr      bool
+	}{
+		{partitionKey: "/customerId", sub: []string{"/type"}, want: []string{"/customerId", "/type"}},
+		{partitionKey: "/customerId", sub: []string{"/type", "/year"}, want: []string{"/customerId", "/type", "/year"}},
+		{partitionKey: "/type", sub: []string{"/type"}, wantErr: true},
+		{partitionKey: "/customerId", sub: []string{"/type", "/type"}, wantErr: true},
+		{partitionKey: "/customerId", sub: []string{"/type", "/customerId"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := hierarchicalPaths(tt.partitionKey, tt.sub)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s + %v: want an error, got %v", tt.partitionKey, tt.sub, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s + %v: got %v, %v, want %v", tt.partitionKey, tt.sub, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheckSubPartitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		selectors []string
+		inv       inventory
+		sub       []string
+		wantErr   string
+	}{
+		{name: "no subpartition", selectors: []string{"all"}},
+		{name: "customer by type", selectors: []string{"database-v4/customer"}, sub: []string{"/type"}},
+		{name: "a whole schema by type", selectors: []string{"4"}, sub: []string{"/type"}, wantErr: `database-v4\productMeta`},
+		{name: "pattern", selectors: []string{"database-v*/productCategory"}, sub: []string{"/type"}, wantErr: `database-v2\productCategory`},
+		{
+			name:      "clashing containers that exist are skipped",
+			selectors: []string{"4"},
+			inv:       inventory{"database-v4": {"productMeta"}},
+			sub:       []string{"/type"},
+		},
+		{name: "customer by its own key", selectors: []string{"database-v4/customer"}, sub: []string{"/customerId"}, wantErr: "already part of the key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selectors, err := parseSelectors(tt.selectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkSubPartitions(tt.inv, selectors, tt.sub)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPartitionKeyFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []interface{}
+	}{
+		{name: "none", args: nil, want: nil},
+		{name: "string", args: []string{"-pk", "0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161"}, want: []interface{}{"0012D555-C7DE-4C4B-B4A4-2E8A6B8E1161"}},
+		{name: "levels in order", args: []string{"-pk", "c1", "-pk", "salesOrder"}, want: []interface{}{"c1", "salesOrder"}},
+		{name: "number", args: []string{"-pk", "c1", "-pk", "2024"}, want: []interface{}{"c1", float64(2024)}},
+		{name: "decimal", args: []string{"-pk", "1.5"}, want: []interface{}{1.5}},
+		{name: "boolean", args: []string{"-pk", "true"}, want: []interface{}{true}},
+		{name: "quoted number stays a string", args: []string{"-pk", `"2024"`}, want: []interface{}{"2024"}},
+		{name: "null is a string", args: []string{"-pk", "null"}, want: []interface{}{"null"}},
+		{name: "object is a string", args: []string{"-pk", `{"a":1}`}, want: []interface{}{`{"a":1}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("partition", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			values := partitionKeyFlag(fs, "pk", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if got := values(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionKeyValues(t *testing.T) {
+	item := map[string]interface{}{
+		"id":         "1",
+		"customerId": "c1",
+		"year":       float64(2024),
+		"active":     true,
+		"address":    map[string]interface{}{"country": "US", "city": "Seattle"},
+		"tags":       []interface{}{"a"},
+		"deleted":    nil,
+	}
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []interface{}
+		wantErr string
+	}{
+		{name: "string", paths: []string{"/customerId"}, want: []interface{}{"c1"}},
+		{name: "nested", paths: []string{"/address/country"}, want: []interface{}{"US"}},
+		{name: "number", paths: []string{"/year"}, want: []interface{}{float64(2024)}},
+		{name: "boolean", paths: []string{"/active"}, want: []interface{}{true}},
+		{name: "null", paths: []string{"/deleted"}, want: []interface{}{nil}},
+		{name: "hierarchical", paths: []string{"/customerId", "/address/city", "/year"}, want: []interface{}{"c1", "Seattle", float64(2024)}},
+		{name: "missing", paths: []string{"/customerId", "/type"}, wantErr: "has no /type"},
+		{name: "missing nested", paths: []string{"/address/zip"}, wantErr: "has no /address/zip"},
+		{name: "below a scalar", paths: []string{"/customerId/x"}, wantErr: "has no /customerId/x"},
+		{name: "object", paths: []string{"/address"}, wantErr: "not a string, number or boolean"},
+		{name: "array", paths: []string{"/tags"}, wantErr: "not a string, number or boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := partitionKeyValues(item, tt.paths)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyntheticKeyApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     syntheticKey
+		item    map[string]interface{}
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "strings",
+			key:  syntheticKey{Path: "/partitionKey", Sources: []string{"/customerId", "/type"}},
+			item: map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder"},
+			want: map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder", "partitionKey": "c1-salesOrder"},
+		},
+		{
+			name: "numbers, booleans and nested paths",
+			key:  syntheticKey{Path: "/keys/pk", Sources: []string{"/address/country", "/year", "/active"}},
+			item: map[string]interface{}{"id": "1", "address": map[string]interface{}{"country": "US"}, "year": float64(2024), "active": false},
+			want: map[string]interface{}{
+				"id": "1", "address": map[string]interface{}{"country": "US"}, "year": float64(2024), "active": false,
+				"keys": map[string]interface{}{"pk": "US-2024-false"},
+			},
+		},
+		{
+			name: "the same value already there",
+			key:  syntheticKey{Path: "/partitionKey", Sources: []string{"/customerId", "/type"}},
+			item: map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder", "partitionKey": "c1-salesOrder"},
+			want: map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder", "partitionKey": "c1-salesOrder"},
+		},
+		{
+			name:    "another value already there",
+			key:     syntheticKey{Path: "/partitionKey", Sources: []string{"/customerId", "/type"}},
+			item:    map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder", "partitionKey": "c1"},
+			wantErr: "already has /partitionKey",
+		},
+		{
+			name:    "missing source",
+			key:     syntheticKey{Path: "/partitionKey", Sources: []string{"/customerId", "/type"}},
+			item:    map[string]interface{}{"id": "1", "customerId": "c1"},
+			wantErr: "has no /type",
+		},
+		{
+			name:    "object source",
+			key:     syntheticKey{Path: "/partitionKey", Sources: []string{"/address"}},
+			item:    map[string]interface{}{"id": "1", "address": map[string]interface{}{"country": "US"}},
+			wantErr: "not a string, number or boolean",
+		},
+		{
+			name:    "target below a scalar",
+			key:     syntheticKey{Path: "/customerId/pk", Sources: []string{"/type"}},
+			item:    map[string]interface{}{"id": "1", "customerId": "c1", "type": "salesOrder"},
+			wantErr: "/customerId is not an object",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.key.apply(tt.item)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.item, tt.want) {
+				t.Errorf("got  %v\nwant %v", tt.item, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetValueAtPath(t *testing.T) {
+	item := map[string]interface{}{"id": "1", "address": map[string]interface{}{"city": "Seattle"}, "name": "n"}
+	for path, value := range map[string]interface{}{
+		"/type":            "customer",
+		"/address/country": "US",
+		"/a/b/c":           float64(1),
+	} {
+		if err := setValueAtPath(item, path, value); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got, ok := valueAtPath(item, path); !ok || got != value {
+			t.Errorf("%s = %v, %v after setting it to %v", path, got, ok, value)
+		}
+	}
+	if city, _ := valueAtPath(item, "/address/city"); city != "Seattle" {
+		t.Errorf("/address/city = %v, setting a sibling lost it", city)
+	}
+	if err := setValueAtPath(item, "/name/first", "x"); err == nil {
+		t.Error("setting below a string succeeded")
+	}
+}
+
+func TestSyntheticKeyFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []syntheticKey
+		wantErr bool
+	}{
+		{args: nil, want: nil},
+		{
+			args: []string{"-synthetic", "/partitionKey=/customerId,/type"},
+			want: []syntheticKey{{Path: "/partitionKey", Sources: []string{"/customerId", "/type"}}},
+		},
+		{
+			args: []string{"-synthetic", " /pk = /address/country , /year ", "-synthetic", "/other=/id"},
+			want: []syntheticKey{
+				{Path: "/pk", Sources: []string{"/address/country", "/year"}},
+				{Path: "/other", Sources: []string{"/id"}},
+			},
+		},
+		{args: []string{"-synthetic", "/partitionKey"}, wantErr: true},
+		{args: []string{"-synthetic", "partitionKey=/customerId"}, wantErr: true},
+		{args: []string{"-synthetic", "/partitionKey=customerId"}, wantErr: true},
+		{args: []string{"-synthetic", "/partitionKey="}, wantErr: true},
+		{args: []string{"-synthetic", "/=/customerId"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("import", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		keys := syntheticKeyFlag(fs, "synthetic", "")
+		err := fs.Parse(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: want an error, got %v", tt.args, keys())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if got := keys(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// queryMetrics are the execution statistics Cosmos DB returns for a page of
+// a query in the x-ms-documentdb-query-metrics header. Times are in
+// milliseconds and sizes in bytes.
+type queryMetrics struct {
+	RetrievedDocumentCount int64
+	RetrievedDocumentSize  int64
+	OutputDocumentCount    int64
+	OutputDocumentSize     int64
+	IndexHitDocumentCount  float64
+
+	TotalExecutionTime    float64
+	QueryCompileTime      float64
+	QueryOptimizationTime float64
+	IndexLookupTime       float64
+	DocumentLoadTime      float64
+	VMExecutionTime       float64
+	FunctionExecutionTime float64
+	DocumentWriteTime     float64
+	LogicalPlanBuildTime  float64
+	PhysicalPlanBuildTime float64
+
+	// Pages and RequestCharge aren't in the header; they're filled in by
+	// the caller and summed by add.
+	Pages         int
+	RequestCharge float64
+}
+
+// parseQueryMetrics parses a header such as
+// "totalExecutionTimeInMs=0.39;retrievedDocumentCount=2;...". Members it
+// doesn't know are ignored.
+func parseQueryMetrics(header string) (queryMetrics, error) {
+	m := queryMetrics{Pages: 1}
+	ints := map[string]*int64{
+		"retrievedDocumentCount": &m.RetrievedDocumentCount,
+		"retrievedDocumentSize":  &m.RetrievedDocumentSize,
+		"outputDocumentCount":    &m.OutputDocumentCount,
+		"outputDocumentSize":     &m.OutputDocumentSize,
+	}
+	floats := map[string]*float64{
+		"totalExecutionTimeInMs":         &m.TotalExecutionTime,
+		"queryCompileTimeInMs":           &m.QueryCompileTime,
+		"queryOptimizationTimeInMs":      &m.QueryOptimizationTime,
+		"queryLogicalPlanBuildTimeInMs":  &m.LogicalPlanBuildTime,
+		"queryPhysicalPlanBuildTimeInMs": &m.PhysicalPlanBuildTime,
+		"indexLookupTimeInMs":            &m.IndexLookupTime,
+		"documentLoadTimeInMs":           &m.DocumentLoadTime,
+		"VMExecutionTimeInMs":            &m.VMExecutionTime,
+		"writeOutputTimeInMs":            &m.DocumentWriteTime,
+	}
+
+	var indexUtilization float64
+	for _, part := range strings.Split(header, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		name, value := kv[0], kv[1]
+		switch {
+		case ints[name] != nil:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return m, fmt.Errorf("query metrics %s: %w", name, err)
+			}
+			*ints[name] = n
+		case floats[name] != nil:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return m, fmt.Errorf("query metrics %s: %w", name, err)
+			}
+			*floats[name] = f
+		case name == "systemFunctionExecuteTimeInMs" || name == "userFunctionExecuteTimeInMs":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return m, fmt.Errorf("query metrics %s: %w", name, err)
+			}
+			m.FunctionExecutionTime += f
+		case name == "indexUtilizationRatio":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return m, fmt.Errorf("query metrics %s: %w", name, err)
+			}
+			indexUtilization = f
+		}
+	}
+	// kept as a count so pages can be added up and the ratio taken after
+	m.IndexHitDocumentCount = indexUtilization * float64(m.RetrievedDocumentCount)
+	return m, nil
+}
+
+// add accumulates the metrics of another page.
+func (m *queryMetrics) add(o queryMetrics) {
+	m.RetrievedDocumentCount += o.RetrievedDocumentCount
+	m.RetrievedDocumentSize += o.RetrievedDocumentSize
+	m.OutputDocumentCount += o.OutputDocumentCount
+	m.OutputDocumentSize += o.OutputDocumentSize
+	m.IndexHitDocumentCount += o.IndexHitDocumentCount
+	m.TotalExecutionTime += o.TotalExecutionTime
+	m.QueryCompileTime += o.QueryCompileTime
+	m.QueryOptimizationTime += o.QueryOptimizationTime
+	m.LogicalPlanBuildTime += o.LogicalPlanBuildTime
+	m.PhysicalPlanBuildTime += o.PhysicalPlanBuildTime
+	m.IndexLookupTime += o.IndexLookupTime
+	m.DocumentLoadTime += o.DocumentLoadTime
+	m.VMExecutionTime += o.VMExecutionTime
+	m.FunctionExecutionTime += o.FunctionExecutionTime
+	m.DocumentWriteTime += o.DocumentWriteTime
+	m.Pages += o.Pages
+	m.RequestCharge += o.RequestCharge
+}
+
+// printQueryMetrics renders m under title. A query that retrieves many more
+// documents than it outputs is filtering or sorting without a suitable
+// index, which is usually where its RU goes.
+func printQueryMetrics(w io.Writer, title string, m queryMetrics) {
+	fmt.Fprintf(w, "%s:\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  Retrieved documents\t%d\t(%d bytes)\n", m.RetrievedDocumentCount, m.RetrievedDocumentSize)
+	fmt.Fprintf(tw, "  Output documents\t%d\t(%d bytes)\n", m.OutputDocumentCount, m.OutputDocumentSize)
+	if m.RetrievedDocumentCount > 0 {
+		fmt.Fprintf(tw, "  Output / retrieved\t%.1f%%\t\n", 100*float64(m.OutputDocumentCount)/float64(m.RetrievedDocumentCount))
+		fmt.Fprintf(tw, "  Index utilization\t%.1f%%\t\n", 100*m.IndexHitDocumentCount/float64(m.RetrievedDocumentCount))
+	}
+	fmt.Fprintf(tw, "  Query compile time\t%.2f ms\t\n", m.QueryCompileTime)
+	fmt.Fprintf(tw, "  Logical plan build time\t%.2f ms\t\n", m.LogicalPlanBuildTime)
+	fmt.Fprintf(tw, "  Physical plan build time\t%.2f ms\t\n", m.PhysicalPlanBuildTime)
+	fmt.Fprintf(tw, "  Query optimization time\t%.2f ms\t\n", m.QueryOptimizationTime)
+	fmt.Fprintf(tw, "  Index lookup time\t%.2f ms\t\n", m.IndexLookupTime)
+	fmt.Fprintf(tw, "  Document load time\t%.2f ms\t\n", m.DocumentLoadTime)
+	fmt.Fprintf(tw, "  VM execution time\t%.2f ms\t\n", m.VMExecutionTime)
+	if m.FunctionExecutionTime > 0 {
+		fmt.Fprintf(tw, "  Function execution time\t%.2f ms\t\n", m.FunctionExecutionTime)
+	}
+	fmt.Fprintf(tw, "  Document write time\t%.2f ms\t\n", m.DocumentWriteTime)
+	fmt.Fprintf(tw, "  Total execution time\t%.2f ms\t\n", m.TotalExecutionTime)
+	if m.RequestCharge > 0 {
+		fmt.Fprintf(tw, "  Request charge\t%.2f RU\t\n", m.RequestCharge)
+	}
+	if m.Pages > 1 {
+		fmt.Fprintf(tw, "  Pages\t%d\t\n", m.Pages)
+	}
+	tw.Flush()
+}
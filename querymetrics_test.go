@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// queryMetricsHeader is an x-ms-documentdb-query-metrics header as returned
+// for a cross-partition query without a suitable index.
+const queryMetricsHeader = "totalExecutionTimeInMs=33.67;queryCompileTimeInMs=0.06;queryLogicalPlanBuildTimeInMs=0.02;" +
+	"queryPhysicalPlanBuildTimeInMs=0.10;queryOptimizationTimeInMs=0.00;VMExecutionTimeInMs=32.56;" +
+	"indexLookupTimeInMs=0.36;documentLoadTimeInMs=9.58;systemFunctionExecuteTimeInMs=0.25;" +
+	"userFunctionExecuteTimeInMs=0.50;retrievedDocumentCount=2000;retrievedDocumentSize=1125600;" +
+	"outputDocumentCount=20;outputDocumentSize=11256;writeOutputTimeInMs=18.10;indexUtilizationRatio=0.01"
+
+func TestParseQueryMetrics(t *testing.T) {
+	got, err := parseQueryMetrics(queryMetricsHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := queryMetrics{
+		RetrievedDocumentCount: 2000,
+		RetrievedDocumentSize:  1125600,
+		OutputDocumentCount:    20,
+		OutputDocumentSize:     11256,
+		IndexHitDocumentCount:  20,
+		TotalExecutionTime:     33.67,
+		QueryCompileTime:       0.06,
+		QueryOptimizationTime:  0,
+		IndexLookupTime:        0.36,
+		DocumentLoadTime:       9.58,
+		VMExecutionTime:        32.56,
+		FunctionExecutionTime:  0.75,
+		DocumentWriteTime:      18.10,
+		LogicalPlanBuildTime:   0.02,
+		PhysicalPlanBuildTime:  0.10,
+		Pages:                  1,
+	}
+	if got != want {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseQueryMetricsIgnoresUnknownMembers(t *testing.T) {
+	got, err := parseQueryMetrics("retrievedDocumentCount=3; someNewMetricInMs=1.5;;noValue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RetrievedDocumentCount != 3 || got.Pages != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestParseQueryMetricsRejectsBadValues(t *testing.T) {
+	for _, header := range []string{
+		"retrievedDocumentCount=1.5",
+		"totalExecutionTimeInMs=fast",
+		"userFunctionExecuteTimeInMs=",
+		"indexUtilizationRatio=x",
+	} {
+		if _, err := parseQueryMetrics(header); err == nil {
+			t.Errorf("parseQueryMetrics(%q) succeeded, want an error", header)
+		}
+	}
+}
+
+func TestQueryMetricsAdd(t *testing.T) {
+	page, err := parseQueryMetrics(queryMetricsHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.RequestCharge = 10.5
+	total := page
+	total.add(page)
+	if total.Pages != 2 || total.RetrievedDocumentCount != 4000 || total.RequestCharge != 21 || total.IndexHitDocumentCount != 40 {
+		t.Errorf("got %+v", total)
+	}
+}
+
+func TestPrintQueryMetrics(t *testing.T) {
+	m, err := parseQueryMetrics(queryMetricsHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	printQueryMetrics(&out, "Query metrics", m)
+	for _, want := range []string{
+		"Output / retrieved",
+		"Index utilization",
+		"Query compile time",
+		"Logical plan build time",
+		"Physical plan build time",
+		"Query optimization time",
+		"Function execution time",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output has no %q row:\n%s", want, out.String())
+		}
+	}
+	rows := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[len(fields)-1] == "ms" {
+			rows[strings.Join(fields[:len(fields)-2], " ")] = fields[len(fields)-2]
+		}
+	}
+	for row, want := range map[string]string{
+		"Query compile time":       "0.06",
+		"Logical plan build time":  "0.02",
+		"Physical plan build time": "0.10",
+		"Query optimization time":  "0.00",
+	} {
+		if rows[row] != want {
+			t.Errorf("%s = %q ms, want %s", row, rows[row], want)
+		}
+	}
+	if strings.Contains(out.String(), "Pages") {
+		t.Errorf("a single page shouldn't print a Pages row:\n%s", out.String())
+	}
+}
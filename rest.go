@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// restAPIVersion matches the version the SDK sends.
+const restAPIVersion = "2020-11-05"
+
+// restClient calls Cosmos DB REST endpoints the SDK version we build against
+// doesn't expose, such as account metadata. It shares the profile's auth,
+// retry and transport settings with the SDK client.
+type restClient struct {
+	endpoint string
+	pipeline runtime.Pipeline
+}
+
+// restResource identifies the resource a request addresses; key auth signs
+// over it.
+type restResource struct {
+	resourceType string
+	resourceLink string
+}
+
+func newRESTClient(p profile) (*restClient, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	options, err := p.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var auth policy.Policy
+	switch p.authMode() {
+	case authKey:
+		key, err := base64.StdEncoding.DecodeString(p.Key)
+		if err != nil {
+			return nil, err
+		}
+		auth = keyAuthPolicy{key: key}
+	case authResourceToken:
+		auth = resourceTokenPolicy{token: p.ResourceToken}
+	default:
+		cred, err := p.tokenCredential()
+		if err != nil {
+			return nil, err
+		}
+		scope, err := accountScope(p.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		auth = &tokenAuthPolicy{cred: cred, scope: scope}
+	}
+
+	pipeline := runtime.NewPipeline("go-cosmos", "v0.1.0", runtime.PipelineOptions{
+		PerRetry: []policy.Policy{auth},
+	}, &options.ClientOptions)
+
+	return &restClient{
+		endpoint: strings.TrimSuffix(p.Endpoint, "/"),
+		pipeline: pipeline,
+	}, nil
+}
+
+// do sends a request for the resource at path and decodes the JSON response
+// into v. Non-2xx responses are returned as *azcore.ResponseError so they can
+// be classified like SDK errors.
+func (c *restClient) do(ctx context.Context, method, path string, resource restResource, headers map[string]string, body interface{}, v interface{}) (*http.Response, error) {
+	req, err := runtime.NewRequest(ctx, method, c.endpoint+path)
+	if err != nil {
+		return nil, err
+	}
+	req.SetOperationValue(resource)
+	req.Raw().Header.Set("x-ms-version", restAPIVersion)
+	req.Raw().Header.Set("Accept", "application/json")
+	if body != nil {
+		if err := runtime.MarshalAsJSON(req, body); err != nil {
+			return nil, err
+		}
+	}
+	// after the body, so a caller can override its Content-Type
+	for k, v := range headers {
+		req.Raw().Header.Set(k, v)
+	}
+
+	resp, err := c.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, runtime.NewResponseError(resp)
+	}
+	if v != nil {
+		if err := runtime.UnmarshalAsJSON(resp, v); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+func (c *restClient) get(ctx context.Context, path string, resource restResource, v interface{}) error {
+	_, err := c.do(ctx, http.MethodGet, path, resource, nil, nil, v)
+	return err
+}
+
+// accountProperties is the subset of the database account resource we use.
+type accountProperties struct {
+	ID                string `json:"id"`
+	WritableLocations []struct {
+		Name string `json:"name"`
+	} `json:"writableLocations"`
+	ReadableLocations []struct {
+		Name string `json:"name"`
+	} `json:"readableLocations"`
+}
+
+func (c *restClient) readAccount(ctx context.Context) (accountProperties, error) {
+	var account accountProperties
+	err := c.get(ctx, "/", restResource{}, &account)
+	return account, err
+}
+
+// keyAuthPolicy signs requests with the account key.
+type keyAuthPolicy struct {
+	key []byte
+}
+
+func (p keyAuthPolicy) Do(req *policy.Request) (*http.Response, error) {
+	var resource restResource
+	req.OperationValue(&resource)
+
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Raw().Header.Set("x-ms-date", date)
+
+	// https://docs.microsoft.com/rest/api/cosmos-db/access-control-on-cosmosdb-resources#constructkeytoken
+	stringToSign := strings.ToLower(req.Raw().Method) + "\n" +
+		strings.ToLower(resource.resourceType) + "\n" +
+		resource.resourceLink + "\n" +
+		strings.ToLower(date) + "\n" +
+		"\n"
+	h := hmac.New(sha256.New, p.key)
+	_, _ = h.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	req.Raw().Header.Set("Authorization", url.QueryEscape("type=master&ver=1.0&sig="+signature))
+	return req.Next()
+}
+
+// tokenAuthPolicy authorizes requests with an Azure AD token, caching it
+// until shortly before it expires.
+type tokenAuthPolicy struct {
+	cred  azcore.TokenCredential
+	scope string
+
+	mu    sync.Mutex
+	token azcore.AccessToken
+}
+
+func (p *tokenAuthPolicy) Do(req *policy.Request) (*http.Response, error) {
+	p.mu.Lock()
+	if time.Until(p.token.ExpiresOn) < 2*time.Minute {
+		token, err := p.cred.GetToken(req.Raw().Context(), policy.TokenRequestOptions{Scopes: []string{p.scope}})
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		p.token = token
+	}
+	token := p.token.Token
+	p.mu.Unlock()
+
+	req.Raw().Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Raw().Header.Set("Authorization", url.QueryEscape("type=aad&ver=1.0&sig="+token))
+	return req.Next()
+}
+
+// databaseInfo and containerInfo are the subsets of the database and
+// container resources we list.
+type databaseInfo struct {
+	ID  string `json:"id"`
+	RID string `json:"_rid"`
+}
+
+type containerInfo struct {
+	ID           string                 `json:"id"`
+	RID          string                 `json:"_rid"`
+	PartitionKey partitionKeyDefinition `json:"partitionKey"`
+	DefaultTTL   *int32                 `json:"defaultTtl"`
+}
+
+// readFeed pages through a feed such as /dbs or /dbs/{db}/colls, passing the
+// raw JSON of each page to fn.
+func (c *restClient) readFeed(ctx context.Context, path string, resource restResource, fn func(page []byte) error) error {
+	continuation := ""
+	for {
+		headers := map[string]string{}
+		if continuation != "" {
+			headers["x-ms-continuation"] = continuation
+		}
+		resp, err := c.do(ctx, http.MethodGet, path, resource, headers, nil, nil)
+		if err != nil {
+			return err
+		}
+		page, err := runtime.Payload(resp)
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		continuation = resp.Header.Get("x-ms-continuation")
+		if continuation == "" {
+			return nil
+		}
+	}
+}
+
+func (c *restClient) listDatabases(ctx context.Context) ([]databaseInfo, error) {
+	var databases []databaseInfo
+	err := c.readFeed(ctx, "/dbs", restResource{resourceType: "dbs"}, func(page []byte) error {
+		feed := struct {
+			Databases []databaseInfo `json:"Databases"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		databases = append(databases, feed.Databases...)
+		return nil
+	})
+	return databases, err
+}
+
+func (c *restClient) listContainers(ctx context.Context, databaseName string) ([]containerInfo, error) {
+	link := "dbs/" + databaseName
+	var containers []containerInfo
+	err := c.readFeed(ctx, "/"+link+"/colls", restResource{resourceType: "colls", resourceLink: link}, func(page []byte) error {
+		feed := struct {
+			DocumentCollections []containerInfo `json:"DocumentCollections"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		containers = append(containers, feed.DocumentCollections...)
+		return nil
+	})
+	return containers, err
+}
+
+// countItems returns the number of documents in a container from the quota
+// usage the service reports, which is much cheaper than a COUNT query. The
+// figure is refreshed periodically by the service, so it can lag slightly.
+func (c *restClient) countItems(ctx context.Context, databaseName, containerName string) (int64, error) {
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	headers := map[string]string{"x-ms-documentdb-populatequotainfo": "true"}
+	resp, err := c.do(ctx, http.MethodGet, "/"+link, restResource{resourceType: "colls", resourceLink: link}, headers, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// x-ms-resource-usage looks like "documentsSize=0;documentsCount=42;..."
+	for _, part := range strings.Split(resp.Header.Get("x-ms-resource-usage"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 && kv[0] == "documentsCount" {
+			return strconv.ParseInt(kv[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no document count reported for %s", link)
+}
+
+// readItems pages through every document in a container, across all
+// partitions, passing each one to fn.
+func (c *restClient) readItems(ctx context.Context, databaseName, containerName string, fn func(item json.RawMessage) error) error {
+	link := "dbs/" + databaseName + "/colls/" + containerName
+	return c.readFeed(ctx, "/"+link+"/docs", restResource{resourceType: "docs", resourceLink: link}, func(page []byte) error {
+		feed := struct {
+			Documents []json.RawMessage `json:"Documents"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		for _, item := range feed.Documents {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
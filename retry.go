@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// statusRetryWith is the Cosmos DB specific 449 status, returned when a
+// write raced with another write and should simply be tried again.
+const statusRetryWith = 449
+
+// retryPolicy controls how failed requests are retried. It is applied in the
+// client pipeline so every operation, including queries and batches, gets the
+// same behaviour. Throttled responses honour the service's Retry-After header.
+type retryPolicy struct {
+	MaxRetries    int32
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	TryTimeout    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	MaxRetries:    5,
+	RetryDelay:    500 * time.Millisecond,
+	MaxRetryDelay: 30 * time.Second,
+}
+
+// applyEnvironment returns p with the AZURE_COSMOS_MAX_RETRIES,
+// AZURE_COSMOS_RETRY_DELAY, AZURE_COSMOS_MAX_RETRY_DELAY and
+// AZURE_COSMOS_TRY_TIMEOUT overrides applied.
+func (p retryPolicy) applyEnvironment() (retryPolicy, error) {
+	if v := os.Getenv("AZURE_COSMOS_MAX_RETRIES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return p, fmt.Errorf("AZURE_COSMOS_MAX_RETRIES: %w", err)
+		}
+		if n < 0 {
+			return p, fmt.Errorf("AZURE_COSMOS_MAX_RETRIES: %d is negative, use 0 for no retries", n)
+		}
+		p.MaxRetries = int32(n)
+	}
+
+	durations := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"AZURE_COSMOS_RETRY_DELAY", &p.RetryDelay},
+		{"AZURE_COSMOS_MAX_RETRY_DELAY", &p.MaxRetryDelay},
+		{"AZURE_COSMOS_TRY_TIMEOUT", &p.TryTimeout},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", d.env, err)
+		}
+		*d.dst = parsed
+	}
+
+	return p, nil
+}
+
+func (p retryPolicy) retryOptions() policy.RetryOptions {
+	// azcore treats 0 as unset and retries its default 3 times; -1 is how it
+	// spells no retries
+	maxRetries := p.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = -1
+	}
+	return policy.RetryOptions{
+		MaxRetries:    maxRetries,
+		RetryDelay:    p.RetryDelay,
+		MaxRetryDelay: p.MaxRetryDelay,
+		TryTimeout:    p.TryTimeout,
+		StatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			statusRetryWith,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// writeRetryStatusCodes are the statuses a write is retried on: the service
+// answers them without having applied the write. After a timeout or a server
+// error it may have, and trying again would report the caller's own write as
+// a conflict, or a changed ETag, or a missing item.
+var writeRetryStatusCodes = []int{http.StatusTooManyRequests, statusRetryWith}
+
+// writeRetryPolicy narrows the retries of writes to writeRetryStatusCodes. It
+// is a per-call policy, so it runs before the retry policy and hands it the
+// narrower options through the request's context.
+type writeRetryPolicy struct {
+	options policy.RetryOptions
+}
+
+func (p writeRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if repeatable(req.Raw()) {
+		return req.Next()
+	}
+	options := p.options
+	options.StatusCodes = writeRetryStatusCodes
+	return req.Clone(runtime.WithRetryOptions(req.Raw().Context(), options)).Next()
+}
+
+// writeErrorPolicy stops the retry policy from retrying a write whose
+// request failed after it may have reached the service, such as a try that
+// timed out. It runs on every try, after the retry policy.
+type writeErrorPolicy struct{}
+
+func (writeErrorPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if err == nil || repeatable(req.Raw()) {
+		return resp, err
+	}
+	// a connection that was never made can't have written anything
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return resp, err
+	}
+	return resp, nonRetriableError{err}
+}
+
+// nonRetriableError marks err as not to be retried, the way azcore's retry
+// policy recognizes.
+type nonRetriableError struct {
+	error
+}
+
+func (nonRetriableError) NonRetriable() {}
+
+func (e nonRetriableError) Unwrap() error {
+	return e.error
+}
+
+// repeatable reports whether sending req twice has the same effect as
+// sending it once: reads and queries, which are POSTs, but no other writes.
+func repeatable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		// the SDK and the REST client name queries differently
+		return req.Header.Get("x-ms-documentdb-query") == "True" || req.Header.Get("x-ms-documentdb-isquery") == "True"
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// countingTransport answers every request with status, or fails it with err,
+// counting the attempts.
+type countingTransport struct {
+	status   int
+	err      error
+	attempts int
+}
+
+func (t *countingTransport) Do(req *http.Request) (*http.Response, error) {
+	t.attempts++
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &http.Response{StatusCode: t.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestWriteRetries(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("i/o timeout")}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name         string
+		method       string
+		header       string
+		status       int
+		err          error
+		wantAttempts int
+	}{
+		{name: "read retried on 503", method: http.MethodGet, status: http.StatusServiceUnavailable, wantAttempts: 4},
+		{name: "read retried after a timeout", method: http.MethodGet, err: timeout, wantAttempts: 4},
+		{name: "sdk query retried on 408", method: http.MethodPost, header: "x-ms-documentdb-query", status: http.StatusRequestTimeout, wantAttempts: 4},
+		{name: "rest query retried on 500", method: http.MethodPost, header: "x-ms-documentdb-isquery", status: http.StatusInternalServerError, wantAttempts: 4},
+		{name: "create retried on 429", method: http.MethodPost, status: http.StatusTooManyRequests, wantAttempts: 4},
+		{name: "create retried on 449", method: http.MethodPost, status: statusRetryWith, wantAttempts: 4},
+		{name: "create not retried on 408", method: http.MethodPost, status: http.StatusRequestTimeout, wantAttempts: 1},
+		{name: "create not retried on 503", method: http.MethodPost, status: http.StatusServiceUnavailable, wantAttempts: 1},
+		{name: "create not retried after a timeout", method: http.MethodPost, err: timeout, wantAttempts: 1},
+		{name: "create retried when it couldn't connect", method: http.MethodPost, err: refused, wantAttempts: 4},
+		{name: "replace not retried on 504", method: http.MethodPut, status: http.StatusGatewayTimeout, wantAttempts: 1},
+		{name: "delete not retried on 502", method: http.MethodDelete, status: http.StatusBadGateway, wantAttempts: 1},
+		{name: "create succeeds first time", method: http.MethodPost, status: http.StatusCreated, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSettings
+			s.Retry = retryPolicy{MaxRetries: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond}
+			options := s.clientOptions()
+			transport := &countingTransport{status: tt.status, err: tt.err}
+			options.Transport = transport
+			pipeline := runtime.NewPipeline("go-cosmos", "test", runtime.PipelineOptions{}, &options.ClientOptions)
+
+			req, err := runtime.NewRequest(context.Background(), tt.method, "https://acct.documents.azure.com/dbs/d/colls/c/docs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Raw().Header.Set(tt.header, "True")
+			}
+			_, err = pipeline.Do(req)
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if transport.attempts != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", transport.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
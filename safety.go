@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultBackupDir is where --backup and export write to unless told
+// otherwise.
+const defaultBackupDir = "backups"
+
+// safety is the single gate every delete and replace goes through. Protected
+// profiles refuse them outright, --dry-run reports what would change instead
+// of changing it, deletes must be confirmed by typing the name of what is
+// being deleted, and --backup exports data before it is removed.
+type safety struct {
+	profile   string
+	protected bool
+	dryRun    bool
+	backup    bool
+	backupDir string
+	// rest describes what a delete would remove and takes backups.
+	rest *restClient
+}
+
+func newSafety(opts globalOptions, p profile, rc *restClient) *safety {
+	s := &safety{
+		profile:   p.Name,
+		protected: p.Protected,
+		dryRun:    opts.DryRun,
+		backup:    opts.Backup,
+		backupDir: opts.BackupDir,
+		rest:      rc,
+	}
+	if s.backupDir == "" {
+		s.backupDir = defaultBackupDir
+	}
+	return s
+}
+
+// errProtected is wrapped by the errors a protected profile refuses with.
+var errProtected = errors.New("profile is protected")
+
+func (s *safety) checkProtected(action string) error {
+	if s.protected {
+		return fmt.Errorf("%w: profile %q refuses to %s", errProtected, s.profile, action)
+	}
+	return nil
+}
+
+// allowWrite gates replaces and other writes that overwrite existing data.
+// It reports false, without an error, when the write should be skipped
+// because this is a dry run.
+func (s *safety) allowWrite(action string) (bool, error) {
+	if err := s.checkProtected(action); err != nil {
+		return false, err
+	}
+	if s.dryRun {
+		fmt.Printf("[dry-run] would %s\n", action)
+		return false, nil
+	}
+	return true, nil
+}
+
+// confirmDelete gates a delete of the named resource. details describes what
+// would be removed and is shown before asking for the name to be typed back.
+func (s *safety) confirmDelete(ctx context.Context, kind, name, details string) (bool, error) {
+	action := fmt.Sprintf("delete %s [%v]", kind, name)
+	if err := s.checkProtected(action); err != nil {
+		return false, err
+	}
+
+	fmt.Printf("About to %s:\n%s\n", action, details)
+	if s.dryRun {
+		fmt.Printf("[dry-run] nothing deleted\n")
+		return false, nil
+	}
+
+	fmt.Printf("Type the %s name [%v] to confirm deletion: ", kind, name)
+	response, err := readLine(ctx)
+	if err != nil {
+		return false, err
+	}
+	if response != name {
+		fmt.Printf("Confirmation did not match, %s [%v] not deleted\n", kind, name)
+		return false, nil
+	}
+	return true, nil
+}
+
+// describeDatabase lists the containers in the database with their item
+// counts. exists is false if the database isn't there.
+func (s *safety) describeDatabase(ctx context.Context, databaseName string) (details string, exists bool, err error) {
+	containers, err := s.rest.listContainers(ctx, databaseName)
+	if isNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if len(containers) == 0 {
+		return "  (no containers)", true, nil
+	}
+
+	var lines []string
+	for _, container := range containers {
+		lines = append(lines, s.describeContainer(ctx, databaseName, container.ID))
+	}
+	return strings.Join(lines, "\n"), true, nil
+}
+
+func (s *safety) describeContainer(ctx context.Context, databaseName, containerName string) string {
+	count := "unknown number of"
+	if n, err := s.rest.countItems(ctx, databaseName, containerName); err == nil {
+		count = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("  container [%v]: %s items", containerName, count)
+}
+
+// backupDatabase exports the database before it is deleted, if --backup was
+// given.
+func (s *safety) backupDatabase(ctx context.Context, databaseName string) error {
+	if !s.backup {
+		return nil
+	}
+	dir := backupDir(s.backupDir, databaseName)
+	log.Printf("Backing up database [%v] to %v\n", databaseName, dir)
+	return exportDatabase(ctx, s.rest, databaseName, dir)
+}
+
+// backupContainer exports a container before it is deleted, if --backup was
+// given.
+func (s *safety) backupContainer(ctx context.Context, databaseName, containerName string) error {
+	if !s.backup {
+		return nil
+	}
+	dir := backupDir(s.backupDir, databaseName)
+	log.Printf("Backing up container [%v] to %v\n", containerName, dir)
+	_, err := exportContainer(ctx, s.rest, databaseName, containerName, dir)
+	return err
+}
+
+// backupItem saves a single item before it is deleted, if --backup was given.
+func (s *safety) backupItem(databaseName, containerName, id string, item map[string]interface{}) error {
+	if !s.backup {
+		return nil
+	}
+	dir := backupDir(s.backupDir, databaseName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, containerName+"-"+id+".json")
+	log.Printf("Backing up item [%v] to %v\n", id, path)
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaVersions are the database versions of the MS Learn data modeling
+// journey, each living in its own database-v<n>.
+var schemaVersions = []int{1, 2, 3, 4}
+
+func schemaDatabaseName(version int) string {
+	return "database-v" + strconv.Itoa(version)
+}
+
+// sampleContainer is a container of the sample schemas, with its partition
+// key and the URL its data is imported from.
+type sampleContainer struct {
+	URL       string
+	PK        string
+	Database  string
+	Container string
+}
+
+var sampleContainers = []sampleContainer{
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/customer",
+		PK:        "id",
+		Database:  "database-v2",
+		Container: "customer",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v2/productCategory",
+		PK:        "type",
+		Database:  "database-v2",
+		Container: "productCategory",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v3/product",
+		PK:        "categoryId",
+		Database:  "database-v3",
+		Container: "product",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v3/productCategory",
+		PK:        "type",
+		Database:  "database-v3",
+		Container: "productCategory",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/customer",
+		PK:        "customerId",
+		Database:  "database-v4",
+		Container: "customer",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/product",
+		PK:        "categoryId",
+		Database:  "database-v4",
+		Container: "product",
+	},
+	{
+		URL:       "https://raw.githubusercontent.com/MicrosoftDocs/mslearn-cosmosdb-modules-central/main/data/fullset/database-v4/productMeta",
+		PK:        "type",
+		Database:  "database-v4",
+		Container: "productMeta",
+	},
+}
+
+// selector picks databases, or containers within them, by name or glob
+// pattern. An empty container selects the whole database.
+type selector struct {
+	database  string
+	container string
+}
+
+// parseSelectors turns arguments such as "4", "v4", "database-v4",
+// "database-v4/customer" or "database-v*/product*" into selectors. No
+// arguments, or "all", selects every schema database.
+func parseSelectors(args []string) ([]selector, error) {
+	var selectors []selector
+	for _, arg := range args {
+		for _, field := range strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if field == "all" {
+				selectors = append(selectors, allSchemaSelectors()...)
+				continue
+			}
+
+			s := selector{database: field}
+			if i := strings.Index(field, "/"); i >= 0 {
+				s = selector{database: field[:i], container: field[i+1:]}
+			}
+			// a bare schema version, with or without the "v"
+			if n, err := strconv.Atoi(strings.TrimPrefix(s.database, "v")); err == nil {
+				s.database = schemaDatabaseName(n)
+			}
+
+			for _, pattern := range []string{s.database, s.container} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("bad pattern %q: %w", field, err)
+				}
+			}
+			if s.database == "" {
+				return nil, fmt.Errorf("bad selector %q: no database", field)
+			}
+			selectors = append(selectors, s)
+		}
+	}
+
+	if len(selectors) == 0 {
+		return allSchemaSelectors(), nil
+	}
+	return selectors, nil
+}
+
+// readSelectors asks which databases or containers to act on, defaulting to
+// every schema database.
+func readSelectors(ctx context.Context, verb string) ([]selector, error) {
+	fmt.Printf("Schema versions, containers or patterns to %s, e.g. 4 database-v4/customer database-v*/product* [all]: ", verb)
+	line, err := readLine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseSelectors([]string{line})
+}
+
+func allSchemaSelectors() []selector {
+	var selectors []selector
+	for _, version := range schemaVersions {
+		selectors = append(selectors, selector{database: schemaDatabaseName(version)})
+	}
+	return selectors
+}
+
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// selectsDatabase reports whether any selector picks the whole database.
+func selectsDatabase(selectors []selector, databaseName string) bool {
+	for _, s := range selectors {
+		if s.container == "" && match(s.database, databaseName) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsContainer reports whether any selector picks the container, either
+// directly or as part of its whole database.
+func selectsContainer(selectors []selector, databaseName, containerName string) bool {
+	for _, s := range selectors {
+		if !match(s.database, databaseName) {
+			continue
+		}
+		if s.container == "" || match(s.container, containerName) {
+			return true
+		}
+	}
+	return false
+}
+
+// inventory is what exists on the account: database name to container names.
+type inventory map[string][]string
+
+func listInventory(ctx context.Context, rc *restClient) (inventory, error) {
+	databases, err := rc.listDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := inventory{}
+	for _, db := range databases {
+		containers, err := rc.listContainers(ctx, db.ID)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, c := range containers {
+			names = append(names, c.ID)
+		}
+		sort.Strings(names)
+		inv[db.ID] = names
+	}
+	return inv, nil
+}
+
+func (inv inventory) databases() []string {
+	names := make([]string, 0, len(inv))
+	for name := range inv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (inv inventory) hasContainer(databaseName, containerName string) bool {
+	for _, name := range inv[databaseName] {
+		if name == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// print lists the account's databases and containers, marking with '*' those
+// the selectors pick. A nil selectors marks nothing.
+func (inv inventory) print(selectors []selector) {
+	fmt.Printf("Databases and containers on the account:\n")
+	if len(inv) == 0 {
+		fmt.Printf("  (none)\n")
+	}
+	for _, db := range inv.databases() {
+		fmt.Printf("  %s %s\n", mark(selectsDatabase(selectors, db)), db)
+		for _, c := range inv[db] {
+			fmt.Printf("  %s   %s\n", mark(selectsContainer(selectors, db, c)), c)
+		}
+	}
+}
+
+func mark(selected bool) string {
+	if selected {
+		return "*"
+	}
+	return " "
+}
+
+// runSchemaCommand implements `list`, `create [selector...]` and
+// `teardown [selector...]`.
+func runSchemaCommand(ctx context.Context, opts globalOptions, args []string) error {
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	targets := args[1:]
+	prov := p.provisioning()
+	var policy containerPolicy
+	if args[0] == "create" {
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		requested := provisioningFlags(fs, prov)
+		ttl := ttlFlag(fs, "ttl", "default time to live of new containers: a duration such as 90d, on to let items set their own, or off (default off)")
+		uniqueKeys := uniqueKeyFlag(fs, "unique-key", "comma separated paths of a unique key of new containers, e.g. /emailAddress; repeat for more keys")
+		subpartition := subPartitionFlag(fs, "subpartition", "comma separated paths to partition new containers by under their partition key, e.g. /type, making it hierarchical")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		prov = requested()
+		policy.DefaultTTL = ttl()
+		policy.UniqueKeys = uniqueKeys()
+		policy.SubPartitionKeys = subpartition()
+		if err := prov.validate(); err != nil {
+			return err
+		}
+		targets = fs.Args()
+	}
+
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "list" {
+		inv, err := listInventory(ctx, rc)
+		if err != nil {
+			return err
+		}
+		inv.print(nil)
+		return nil
+	}
+
+	selectors, err := parseSelectors(targets)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	if args[0] == "create" {
+		return CreateDatabase(ctx, client, rc, selectors, true, prov, policy)
+	}
+	return DeleteDatabase(ctx, client, rc, newSafety(opts, p, rc), selectors)
+}
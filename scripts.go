@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// createSalesOrderJS is the example stored procedure the menu installs on
+// first use.
+//
+//go:embed scripts/createSalesOrder.js
+var createSalesOrderJS string
+
+const createSalesOrderID = "createSalesOrder"
+
+// scriptKind is one of the kinds of server-side JavaScript a container can
+// hold. The SDK version we build against has no API for them, so they go
+// through the REST client.
+type scriptKind struct {
+	name         string
+	resourceType string
+	feedMember   string
+	noun         string
+}
+
+var scriptKinds = []scriptKind{
+	{name: "sproc", resourceType: "sprocs", feedMember: "StoredProcedures", noun: "stored procedure"},
+	{name: "trigger", resourceType: "triggers", feedMember: "Triggers", noun: "trigger"},
+	{name: "udf", resourceType: "udfs", feedMember: "UserDefinedFunctions", noun: "user-defined function"},
+}
+
+func lookupScriptKind(name string) (scriptKind, error) {
+	for _, k := range scriptKinds {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return scriptKind{}, fmt.Errorf("unknown script kind %q, use sproc, trigger or udf", name)
+}
+
+// script is a stored procedure, trigger or user-defined function. Only
+// triggers have a type and operation.
+type script struct {
+	ID               string `json:"id"`
+	Body             string `json:"body"`
+	TriggerType      string `json:"triggerType,omitempty"`
+	TriggerOperation string `json:"triggerOperation,omitempty"`
+}
+
+// triggerTypes and triggerOperations are the values the service accepts,
+// spelled as it expects them.
+var (
+	triggerTypes      = []string{"Pre", "Post"}
+	triggerOperations = []string{"All", "Create", "Replace", "Delete", "Upsert"}
+)
+
+// canonical returns the member of values that matches s ignoring case.
+func canonical(s string, values []string) (string, bool) {
+	for _, v := range values {
+		if strings.EqualFold(s, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func scriptsLink(databaseName, containerName string, kind scriptKind) string {
+	return "dbs/" + databaseName + "/colls/" + containerName + "/" + kind.resourceType
+}
+
+func (c *restClient) listScripts(ctx context.Context, databaseName, containerName string, kind scriptKind) ([]script, error) {
+	containerLink := "dbs/" + databaseName + "/colls/" + containerName
+	var scripts []script
+	err := c.readFeed(ctx, "/"+scriptsLink(databaseName, containerName, kind), restResource{resourceType: kind.resourceType, resourceLink: containerLink}, func(page []byte) error {
+		feed := map[string]json.RawMessage{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		var members []script
+		if raw, ok := feed[kind.feedMember]; ok {
+			if err := json.Unmarshal(raw, &members); err != nil {
+				return err
+			}
+		}
+		scripts = append(scripts, members...)
+		return nil
+	})
+	return scripts, err
+}
+
+func (c *restClient) readScript(ctx context.Context, databaseName, containerName string, kind scriptKind, id string) (script, error) {
+	var s script
+	link := scriptsLink(databaseName, containerName, kind) + "/" + id
+	err := c.get(ctx, "/"+link, restResource{resourceType: kind.resourceType, resourceLink: link}, &s)
+	return s, err
+}
+
+// saveScript creates s, or replaces the existing script of the same id.
+func (c *restClient) saveScript(ctx context.Context, databaseName, containerName string, kind scriptKind, s script, replace bool) error {
+	if replace {
+		link := scriptsLink(databaseName, containerName, kind) + "/" + s.ID
+		_, err := c.do(ctx, http.MethodPut, "/"+link, restResource{resourceType: kind.resourceType, resourceLink: link}, nil, s, nil)
+		return err
+	}
+	containerLink := "dbs/" + databaseName + "/colls/" + containerName
+	_, err := c.do(ctx, http.MethodPost, "/"+scriptsLink(databaseName, containerName, kind), restResource{resourceType: kind.resourceType, resourceLink: containerLink}, nil, s, nil)
+	return err
+}
+
+func (c *restClient) deleteScript(ctx context.Context, databaseName, containerName string, kind scriptKind, id string) error {
+	link := scriptsLink(databaseName, containerName, kind) + "/" + id
+	_, err := c.do(ctx, http.MethodDelete, "/"+link, restResource{resourceType: kind.resourceType, resourceLink: link}, nil, nil, nil)
+	return err
+}
+
+// storedProcedureResult is what executing a stored procedure returned: the
+// body it set, and its console.log output when logging was asked for.
+type storedProcedureResult struct {
+	Body          json.RawMessage
+	Log           string
+	RequestCharge float64
+	ActivityID    string
+}
+
+// executeStoredProcedure runs a stored procedure in one logical partition.
+// A stored procedure only sees that partition, and its writes there are a
+// single transaction.
+func (c *restClient) executeStoredProcedure(ctx context.Context, databaseName, containerName, id, partitionKey string, params []interface{}, logging bool) (storedProcedureResult, error) {
+	var result storedProcedureResult
+	pk, err := json.Marshal([]string{partitionKey})
+	if err != nil {
+		return result, err
+	}
+	headers := map[string]string{"x-ms-documentdb-partitionkey": string(pk)}
+	if logging {
+		headers["x-ms-documentdb-script-enable-logging"] = "true"
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	kind, _ := lookupScriptKind("sproc")
+	link := scriptsLink(databaseName, containerName, kind) + "/" + id
+	resp, err := c.do(ctx, http.MethodPost, "/"+link, restResource{resourceType: kind.resourceType, resourceLink: link}, headers, params, nil)
+	if err != nil {
+		return result, err
+	}
+	if result.Body, err = runtime.Payload(resp); err != nil {
+		return result, err
+	}
+	result.RequestCharge, _ = strconv.ParseFloat(resp.Header.Get("x-ms-request-charge"), 64)
+	result.ActivityID = resp.Header.Get("x-ms-activity-id")
+	if logs := resp.Header.Get("x-ms-documentdb-script-log-results"); logs != "" {
+		if result.Log, err = url.QueryUnescape(logs); err != nil {
+			result.Log = logs
+		}
+	}
+	return result, nil
+}
+
+// sprocParams turns command line arguments into stored procedure
+// parameters: valid JSON is passed as is, anything else as a string.
+func sprocParams(args []string) []interface{} {
+	params := []interface{}{}
+	for _, arg := range args {
+		if json.Valid([]byte(arg)) {
+			params = append(params, json.RawMessage(arg))
+		} else {
+			params = append(params, arg)
+		}
+	}
+	return params
+}
+
+func printStoredProcedureResult(result storedProcedureResult) {
+	if result.Log != "" {
+		fmt.Printf("Log:\n%s\n", result.Log)
+	}
+	var body interface{}
+	if err := json.Unmarshal(result.Body, &body); err == nil {
+		if b, err := json.MarshalIndent(body, "", "    "); err == nil {
+			result.Body = b
+		}
+	}
+	if len(result.Body) > 0 {
+		fmt.Printf("%s\n", result.Body)
+	}
+	log.Printf("Stored procedure executed. ActivityId %s. Consuming %v RU\n", result.ActivityID, result.RequestCharge)
+}
+
+// CreateSalesOrderServerSide does what UpdateSalesOrderQty does with a
+// transactional batch, but in the createSalesOrder stored procedure: the
+// customer is read, the order stored and the count incremented on the
+// server, in one round trip. The procedure is installed if it is missing.
+func CreateSalesOrderServerSide(ctx context.Context, rc *restClient, guard *safety, databaseName, containerName, customerID string, salesOrder map[string]interface{}) error {
+	log.Printf("Creating a new Sales Order for customer %v in %v\\%v with stored procedure %v\n", customerID, databaseName, containerName, createSalesOrderID)
+	salesOrderJSON, err := json.MarshalIndent(salesOrder, "", "    ")
+	if err != nil {
+		return err
+	}
+	log.Printf("Sales Order:\n")
+	fmt.Printf("%s\n", salesOrderJSON)
+
+	ok, err := guard.allowWrite(fmt.Sprintf("create sales order and increment the salesOrderCount of customer [%v] in %v\\%v", customerID, databaseName, containerName))
+	if !ok {
+		return err
+	}
+
+	kind, _ := lookupScriptKind("sproc")
+	_, err = rc.readScript(ctx, databaseName, containerName, kind, createSalesOrderID)
+	if isNotFound(err) {
+		log.Printf("Installing stored procedure %v in %v\\%v\n", createSalesOrderID, databaseName, containerName)
+		err = rc.saveScript(ctx, databaseName, containerName, kind, script{ID: createSalesOrderID, Body: createSalesOrderJS}, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := rc.executeStoredProcedure(ctx, databaseName, containerName, createSalesOrderID, customerID, []interface{}{salesOrder}, false)
+	if err != nil {
+		return err
+	}
+	printStoredProcedureResult(result)
+	return nil
+}
+
+func printScripts(kind scriptKind, scripts []script) {
+	if len(scripts) == 0 {
+		fmt.Printf("No %ss\n", kind.noun)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if kind.name == "trigger" {
+		fmt.Fprintf(w, "ID\tTYPE\tOPERATION\tSIZE\n")
+		for _, s := range scripts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d bytes\n", s.ID, s.TriggerType, s.TriggerOperation, len(s.Body))
+		}
+	} else {
+		fmt.Fprintf(w, "ID\tSIZE\n")
+		for _, s := range scripts {
+			fmt.Fprintf(w, "%s\t%d bytes\n", s.ID, len(s.Body))
+		}
+	}
+	w.Flush()
+}
+
+// runScriptCommand implements `script list`, `script create file.js`,
+// `script replace file.js`, `script delete id` and `script exec id` for one
+// container and kind of script.
+func runScriptCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: script [-database name] [-container name] [-kind sproc|trigger|udf] list | create [-id name] [-type pre|post] [-operation all|create|replace|delete|upsert] file.js | replace [-id name] file.js | delete id | exec -pk value [-log] id [param...]"
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("script", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database of the container")
+	containerName := fs.String("container", p.container("customer"), "container the scripts belong to")
+	kindName := fs.String("kind", "sproc", "kind of script: sproc, trigger or udf")
+	id := fs.String("id", "", "create, replace: id of the script, by default the file name without .js")
+	triggerType := fs.String("type", "pre", "create, replace: whether a trigger runs before (pre) or after (post) the write")
+	triggerOperation := fs.String("operation", "all", "create, replace: the writes a trigger runs for: all, create, replace, delete or upsert")
+	partitionKey := fs.String("pk", "", "exec: partition key value the stored procedure runs in")
+	logging := fs.Bool("log", false, "exec: show the stored procedure's console.log output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// flags may also follow the subcommand, as in `script exec -pk 1 name`
+	sub := fs.Args()
+	if len(sub) == 0 {
+		return errors.New(usage)
+	}
+	if err := fs.Parse(sub[1:]); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	kind, err := lookupScriptKind(*kindName)
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	guard := newSafety(opts, p, rc)
+	container := *databaseName + "\\" + *containerName
+
+	switch sub[0] {
+	case "list":
+		if len(rest) > 0 {
+			return errors.New(usage)
+		}
+		scripts, err := rc.listScripts(ctx, *databaseName, *containerName, kind)
+		if err != nil {
+			return err
+		}
+		printScripts(kind, scripts)
+		return nil
+
+	case "create", "replace":
+		if len(rest) != 1 {
+			return errors.New(usage)
+		}
+		body, err := os.ReadFile(rest[0])
+		if err != nil {
+			return err
+		}
+		s := script{ID: *id, Body: string(body)}
+		if s.ID == "" {
+			s.ID = strings.TrimSuffix(filepath.Base(rest[0]), filepath.Ext(rest[0]))
+		}
+		if kind.name == "trigger" {
+			var ok bool
+			if s.TriggerType, ok = canonical(*triggerType, triggerTypes); !ok {
+				return fmt.Errorf("unknown trigger type %q, use pre or post", *triggerType)
+			}
+			if s.TriggerOperation, ok = canonical(*triggerOperation, triggerOperations); !ok {
+				return fmt.Errorf("unknown trigger operation %q, use all, create, replace, delete or upsert", *triggerOperation)
+			}
+		}
+		replace := sub[0] == "replace"
+		ok, err := guard.allowWrite(fmt.Sprintf("%s %s [%v] in %v", sub[0], kind.noun, s.ID, container))
+		if !ok {
+			return err
+		}
+		if err := rc.saveScript(ctx, *databaseName, *containerName, kind, s, replace); err != nil {
+			if isConflict(err) {
+				return fmt.Errorf("%s [%v] already exists in %v, use replace: %w", kind.noun, s.ID, container, err)
+			}
+			return err
+		}
+		done := "Created"
+		if replace {
+			done = "Replaced"
+		}
+		log.Printf("%s %s [%v] in %v\n", done, kind.noun, s.ID, container)
+		return nil
+
+	case "delete":
+		if len(rest) != 1 {
+			return errors.New(usage)
+		}
+		ok, err := guard.confirmDelete(ctx, kind.noun, rest[0], "  in "+container)
+		if !ok {
+			return err
+		}
+		if err := rc.deleteScript(ctx, *databaseName, *containerName, kind, rest[0]); err != nil {
+			return err
+		}
+		log.Printf("Deleted %s [%v] from %v\n", kind.noun, rest[0], container)
+		return nil
+
+	case "exec":
+		if kind.name != "sproc" {
+			return fmt.Errorf("only stored procedures can be executed; triggers run when a write names them and user-defined functions are called from queries")
+		}
+		if len(rest) == 0 || *partitionKey == "" {
+			return errors.New(usage)
+		}
+		// the procedure may write, which a protected profile or a dry run
+		// must not allow
+		ok, err := guard.allowWrite(fmt.Sprintf("execute stored procedure [%v] in %v", rest[0], container))
+		if !ok {
+			return err
+		}
+		result, err := rc.executeStoredProcedure(ctx, *databaseName, *containerName, rest[0], *partitionKey, sprocParams(rest[1:]), *logging)
+		if err != nil {
+			return err
+		}
+		printStoredProcedureResult(result)
+		return nil
+	}
+	return errors.New(usage)
+}
@@ -0,0 +1,42 @@
+// createSalesOrder stores a sales order and increments its customer's
+// salesOrderCount in one transaction, the server-side counterpart of the
+// transactional batch in UpdateSalesOrderQty. Run it with the customer id as
+// the partition key and the order as its only parameter. An order that
+// already exists fails with a conflict, so the count is never raised twice
+// for one order. Any error thrown rolls back both writes.
+function createSalesOrder(order) {
+    var collection = getContext().getCollection();
+    var response = getContext().getResponse();
+
+    if (!order || !order.id || !order.customerId) {
+        throw new Error("the order needs an id and a customerId");
+    }
+
+    var customerLink = collection.getAltLink() + "/docs/" + order.customerId;
+    var accepted = collection.readDocument(customerLink, {}, function (err, customer) {
+        if (err) {
+            throw err;
+        }
+        var accepted = collection.createDocument(collection.getSelfLink(), order, {}, function (err, created) {
+            if (err) {
+                throw err;
+            }
+            customer.salesOrderCount = (customer.salesOrderCount || 0) + 1;
+            var accepted = collection.replaceDocument(customer._self, customer, { etag: customer._etag }, function (err, updated) {
+                if (err) {
+                    throw err;
+                }
+                response.setBody({ order: created.id, salesOrderCount: updated.salesOrderCount });
+            });
+            if (!accepted) {
+                throw new Error("replacing the customer was not accepted, try again");
+            }
+        });
+        if (!accepted) {
+            throw new Error("storing the order was not accepted, try again");
+        }
+    });
+    if (!accepted) {
+        throw new Error("reading the customer was not accepted, try again");
+    }
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+)
+
+// server exposes the database-v4 customer, order and category operations over
+// HTTP. Customers and their orders share the customer container, categories
+// live in productMeta and products in product.
+type server struct {
+	client       *azcosmos.Client
+	guard        *safety
+	databaseName string
+}
+
+// maxRequestBytes bounds request bodies at the size of the largest item
+// Cosmos DB stores.
+const maxRequestBytes = 2 << 20
+
+// httpError is an error with the HTTP status it should be reported with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &httpError{status: http.StatusNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus maps an error onto the status to report it with.
+func errorStatus(err error) int {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	if errors.Is(err, errProtected) {
+		return http.StatusForbidden
+	}
+	switch classifyError(err) {
+	case errKindNotFound:
+		return http.StatusNotFound
+	case errKindConflict:
+		return http.StatusConflict
+	case errKindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case errKindThrottled:
+		return http.StatusTooManyRequests
+	case errKindTimeout:
+		return http.StatusGatewayTimeout
+	case errKindAuth:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Writing response: %v\n", err)
+	}
+}
+
+// writeError reports err as {"error": {"status": 404, "message": "..."}}.
+func writeError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("Internal error: %v\n", err)
+	}
+	body := map[string]interface{}{
+		"error": map[string]interface{}{
+			"status":  status,
+			"message": err.Error(),
+		},
+	}
+	writeJSON(w, status, body)
+}
+
+// statusRecorder remembers the status written so it can be logged.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %v\n", r.Method, r.URL.RequestURI(), rec.status, time.Since(start))
+	})
+}
+
+// ServeHTTP routes requests by path segment:
+//
+//	GET    /customers/{id}
+//	GET    /customers/{id}/orders
+//	POST   /customers/{id}/orders
+//	DELETE /customers/{id}/orders/{orderId}
+//	GET    /categories
+//	GET    /categories/{id}/products
+//
+// List endpoints return one page at a time, see queryPage.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var route handler
+	methods := ""
+	switch {
+	case len(parts) == 2 && parts[0] == "customers":
+		route, methods = s.routeFor(r.Method, map[string]handler{http.MethodGet: s.getCustomer})
+	case len(parts) == 3 && parts[0] == "customers" && parts[2] == "orders":
+		route, methods = s.routeFor(r.Method, map[string]handler{http.MethodGet: s.listOrders, http.MethodPost: s.createOrder})
+	case len(parts) == 4 && parts[0] == "customers" && parts[2] == "orders":
+		route, methods = s.routeFor(r.Method, map[string]handler{http.MethodDelete: s.deleteOrder})
+	case len(parts) == 1 && parts[0] == "categories":
+		route, methods = s.routeFor(r.Method, map[string]handler{http.MethodGet: s.listCategories})
+	case len(parts) == 3 && parts[0] == "categories" && parts[2] == "products":
+		route, methods = s.routeFor(r.Method, map[string]handler{http.MethodGet: s.listProducts})
+	default:
+		writeError(w, notFound("no route for %s", r.URL.Path))
+		return
+	}
+	if route == nil {
+		w.Header().Set("Allow", methods)
+		writeError(w, &httpError{status: http.StatusMethodNotAllowed, msg: fmt.Sprintf("%s not allowed on %s", r.Method, r.URL.Path)})
+		return
+	}
+
+	status, body, err := route(r.Context(), r, parts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+type handler func(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error)
+
+// routeFor picks the handler for method, returning nil and the allowed
+// methods if there is none.
+func (s *server) routeFor(method string, handlers map[string]handler) (handler, string) {
+	if h, ok := handlers[method]; ok {
+		return h, ""
+	}
+	var allowed []string
+	for m := range handlers {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	return nil, strings.Join(allowed, ", ")
+}
+
+func (s *server) getCustomer(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	customerID := parts[1]
+	customer, err := getCustomer(ctx, s.client, s.databaseName, "customer", customerID, customerID)
+	if isNotFound(err) {
+		return 0, nil, notFound("customer %s not found", customerID)
+	}
+	return http.StatusOK, customer, err
+}
+
+func (s *server) listOrders(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	return s.queryPage(ctx, r, "customer", salesOrdersQuery, parts[1])
+}
+
+// createOrder adds an order to the customer and bumps their salesOrderCount
+// in one transactional batch. The order id is generated if not given; an id
+// that is taken answers 409, and a customer changed meanwhile 412. ?ttl=90d
+// makes the order expire, as the ttl flags do.
+func (s *server) createOrder(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	customerID := parts[1]
+	opts := orderOptions{Quiet: true}
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		ttl, err := parseTTL(v)
+		if err != nil {
+			return 0, nil, badRequest("%v", err)
+		}
+		opts.TTL = ttl
+	}
+	order := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		return 0, nil, badRequest("order must be a JSON object: %v", err)
+	}
+	if id, ok := order["id"]; !ok || id == "" {
+		order["id"] = uuid.New().String()
+	} else if _, ok := id.(string); !ok {
+		return 0, nil, badRequest("order id must be a string")
+	}
+	order["type"] = "salesOrder"
+	order["customerId"] = customerID
+
+	err := UpdateSalesOrderQty(ctx, s.client, s.guard, s.databaseName, "customer", customerID, order, opts)
+	if isConflict(err) {
+		return 0, nil, &httpError{status: http.StatusConflict, msg: fmt.Sprintf("order %s already exists", order["id"])}
+	}
+	if isNotFound(err) {
+		return 0, nil, notFound("customer %s not found", customerID)
+	}
+	if s.guard.dryRun {
+		return http.StatusOK, map[string]interface{}{"dryRun": true, "order": order}, err
+	}
+	return http.StatusCreated, order, err
+}
+
+// deleteOrder removes an order and decrements the customer's salesOrderCount
+// in one transactional batch.
+func (s *server) deleteOrder(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	customerID, orderID := parts[1], parts[3]
+	order, err := pointRead(ctx, s.client, s.databaseName, "customer", customerID, orderID)
+	if isNotFound(err) || (err == nil && order["type"] != "salesOrder") {
+		return 0, nil, notFound("order %s not found for customer %s", orderID, customerID)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = DeleteCustomerOrderAndUpdateSalesOrderQty(ctx, s.client, s.guard, s.databaseName, "customer", orderID, customerID, orderOptions{Quiet: true})
+	return http.StatusOK, map[string]interface{}{"deleted": orderID, "dryRun": s.guard.dryRun}, err
+}
+
+func (s *server) listCategories(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	return s.queryPage(ctx, r, "productMeta", categoriesQuery, "category")
+}
+
+func (s *server) listProducts(ctx context.Context, r *http.Request, parts []string) (int, interface{}, error) {
+	return s.queryPage(ctx, r, "product", "SELECT * FROM c", parts[1])
+}
+
+// defaultPageSize and maxPageSize bound the pageSize query parameter of list
+// endpoints.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pagedItems is the body of list endpoints. NextCursor is passed back as the
+// cursor query parameter to fetch the next page, and is omitted on the last.
+type pagedItems struct {
+	Items      []map[string]interface{} `json:"items"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+}
+
+// queryPage answers a list endpoint with one page of the query's results,
+// taking the page size and cursor from the pageSize and cursor query
+// parameters.
+func (s *server) queryPage(ctx context.Context, r *http.Request, containerName, query, partitionKey string) (int, interface{}, error) {
+	pageSize := defaultPageSize
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, nil, badRequest("pageSize must be between 1 and %d", maxPageSize)
+		}
+		pageSize = n
+	}
+	continuation, err := decodeCursor(r.URL.Query().Get("cursor"), partitionKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	page, err := queryItemsPage(ctx, s.client, s.databaseName, containerName, query, partitionKey, int32(pageSize), continuation)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, pagedItems{Items: page.Items, NextCursor: encodeCursor(partitionKey, page.Continuation)}, nil
+}
+
+// runServeCommand implements `serve [-addr host:port]`. The server stops
+// gracefully when the command is interrupted.
+func runServeCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: serve [-addr host:port]")
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+
+	s := &server{
+		client:       client,
+		guard:        newSafety(opts, p, rc),
+		databaseName: p.database("database-v4"),
+	}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           logRequests(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("Serving %v on http://%v\n", s.databaseName, *addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// settings holds the tunables shared by every operation.
+type settings struct {
+	Retry retryPolicy
+	// OperationTimeout bounds a single SDK call, including its retries.
+	// Zero disables the timeout.
+	OperationTimeout time.Duration
+	// ConsistencyLevel, when set, relaxes the account's default consistency
+	// for every request.
+	ConsistencyLevel azcosmos.ConsistencyLevel
+}
+
+var defaultSettings = settings{
+	Retry:            defaultRetryPolicy,
+	OperationTimeout: 60 * time.Second,
+}
+
+// applyEnvironment returns s with the retry overrides and
+// AZURE_COSMOS_OPERATION_TIMEOUT applied.
+func (s settings) applyEnvironment() (settings, error) {
+	retry, err := s.Retry.applyEnvironment()
+	if err != nil {
+		return s, err
+	}
+	s.Retry = retry
+
+	if v := os.Getenv("AZURE_COSMOS_OPERATION_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return s, fmt.Errorf("AZURE_COSMOS_OPERATION_TIMEOUT: %w", err)
+		}
+		s.OperationTimeout = d
+	}
+
+	return s, nil
+}
+
+func (s settings) clientOptions() *azcosmos.ClientOptions {
+	options := &azcosmos.ClientOptions{}
+	options.Retry = s.Retry.retryOptions()
+	options.PerCallPolicies = append(options.PerCallPolicies, writeRetryPolicy{options: options.Retry})
+	options.PerRetryPolicies = append(options.PerRetryPolicies, writeErrorPolicy{})
+	if s.OperationTimeout > 0 {
+		options.PerCallPolicies = append(options.PerCallPolicies, operationTimeoutPolicy{timeout: s.OperationTimeout})
+	}
+	if s.ConsistencyLevel != "" {
+		options.PerCallPolicies = append(options.PerCallPolicies, consistencyLevelPolicy{level: s.ConsistencyLevel})
+	}
+	return options
+}
+
+// operationTimeoutPolicy applies a deadline to each SDK call. It runs once
+// per call, outside the retry policy, so the timeout covers all attempts.
+type operationTimeoutPolicy struct {
+	timeout time.Duration
+}
+
+func (p operationTimeoutPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Raw().Context(), p.timeout)
+	defer cancel()
+	return req.Clone(ctx).Next()
+}
+
+// consistencyLevelPolicy sets the consistency level header on every request,
+// the same header the SDK sends for ItemOptions.ConsistencyLevel.
+type consistencyLevelPolicy struct {
+	level azcosmos.ConsistencyLevel
+}
+
+func (p consistencyLevelPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if req.Raw().Header.Get("x-ms-consistency-level") == "" {
+		req.Raw().Header.Set("x-ms-consistency-level", string(p.level))
+	}
+	return req.Next()
+}
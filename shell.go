@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// shell is the interactive session started when no command is given. It
+// takes both the lettered menu options and the commands, and reports errors
+// instead of exiting.
+type shell struct {
+	opts          globalOptions
+	client        *azcosmos.Client
+	rc            *restClient
+	guard         *safety
+	databaseName  string
+	containerName string
+	// provisioning is the throughput given to databases and containers
+	// the menu creates.
+	provisioning provisioning
+
+	// inventory caches the account's databases and containers for
+	// completion.
+	inventory   inventory
+	inventoryAt time.Time
+}
+
+// completionTimeout bounds how long tab waits for the account, and
+// inventoryTTL how long what it found is reused.
+const (
+	completionTimeout = 2 * time.Second
+	inventoryTTL      = 30 * time.Second
+)
+
+// errUnknownOption is returned by menuOption for input that isn't a menu
+// option, so it can be tried as a command instead.
+var errUnknownOption = errors.New("unknown menu option")
+
+const shellHelp = `Type a menu letter, or a command with its arguments as on the command line:
+  help <command>   show what a command does and its flags
+  x, exit          leave (or Ctrl-D)
+
+Lines can be edited with the arrow keys, Ctrl-A/Ctrl-E and Ctrl-K/Ctrl-U/Ctrl-W.
+Up and down recall earlier lines, which are kept between sessions. Tab
+completes commands, databases and containers.`
+
+// dispatch runs one line of input, already split into words.
+func (s *shell) dispatch(ctx context.Context, args []string) (err error) {
+	// a bug in one command shouldn't end the session
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s panicked: %v\n%s", args[0], r, debug.Stack())
+			err = fmt.Errorf("%s failed unexpectedly: %v", args[0], r)
+		}
+	}()
+
+	if len(args) == 1 {
+		err := s.menuOption(ctx, args[0])
+		if err != errUnknownOption {
+			return err
+		}
+	}
+
+	switch args[0] {
+	case "?", "help":
+		if len(args) > 1 {
+			return printCommandHelp(ctx, s.opts, args[1])
+		}
+		fmt.Println(shellHelp)
+		printCommands(os.Stdout)
+		return nil
+	}
+	if _, ok := lookupCommand(args[0]); ok {
+		return runCommand(ctx, s.opts, args)
+	}
+	return fmt.Errorf("unknown command %q, type help for a list", args[0])
+}
+
+// complete offers command names for the first word, and database and
+// database/container names after it.
+func (s *shell) complete(ctx context.Context, before []string, word string) []string {
+	var names []string
+	switch {
+	case len(before) == 0:
+		names = append(names, "help", "exit")
+		fallthrough
+	case len(before) == 1 && before[0] == "help":
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+	default:
+		if time.Since(s.inventoryAt) > inventoryTTL {
+			ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+			inv, err := listInventory(ctx, s.rc)
+			cancel()
+			if err != nil {
+				return nil
+			}
+			s.inventory, s.inventoryAt = inv, time.Now()
+		}
+		for _, db := range s.inventory.databases() {
+			names = append(names, db)
+			for _, c := range s.inventory[db] {
+				names = append(names, db+"/"+c)
+			}
+		}
+	}
+
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// splitArgs splits a line into words like a shell would: on spaces, except
+// inside single or double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", line: "", want: nil},
+		{name: "blank", line: "  \t ", want: nil},
+		{name: "words", line: "create 4 database-v4/customer", want: []string{"create", "4", "database-v4/customer"}},
+		{name: "extra spaces and tabs", line: "  ttl\tshow   4 ", want: []string{"ttl", "show", "4"}},
+		{name: "double quotes", line: `query -pk 1 "SELECT * FROM c"`, want: []string{"query", "-pk", "1", "SELECT * FROM c"}},
+		{name: "single quotes keep double quotes", line: `q 'SELECT * FROM c WHERE c.name = "x"'`, want: []string{"q", `SELECT * FROM c WHERE c.name = "x"`}},
+		{name: "double quotes keep single quotes", line: `q "WHERE c.type = 'salesOrder'"`, want: []string{"q", "WHERE c.type = 'salesOrder'"}},
+		{name: "quotes inside a word", line: `-pk="a b"c`, want: []string{"-pk=a bc"}},
+		{name: "empty quotes are an argument", line: `script exec ""`, want: []string{"script", "exec", ""}},
+		{name: "unicode", line: "import -container café", want: []string{"import", "-container", "café"}},
+		{name: "unterminated double quote", line: `query "SELECT`, wantErr: `unterminated " quote`},
+		{name: "unterminated single quote", line: `q 'x`, wantErr: "unterminated ' quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitArgs(tt.line)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
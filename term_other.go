@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+// makeRaw isn't supported here, so the shell falls back to reading plain
+// lines without editing, history recall or completion.
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode not supported on this platform")
+}
+
+func terminalColumns(fd int) (int, error) {
+	return 0, errors.New("terminal size not supported on this platform")
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// provisioning is how the databases and containers we create get their
+// throughput. Shared puts it on the database, for its containers to share;
+// otherwise each container gets its own. Throughput is in RU/s, or the
+// maximum RU/s with Autoscale.
+type provisioning struct {
+	Shared     bool  `json:"shared,omitempty"`
+	Autoscale  bool  `json:"autoscale,omitempty"`
+	Throughput int32 `json:"throughput,omitempty"`
+}
+
+// defaultProvisioning is what the samples have always used: 400 RU/s of
+// manual throughput on each container.
+var defaultProvisioning = provisioning{Throughput: 400}
+
+func (p provisioning) validate() error {
+	if p.Autoscale {
+		if p.Throughput < minAutoscaleThroughput || p.Throughput%1000 != 0 {
+			return fmt.Errorf("autoscale max throughput must be a multiple of 1000 RU/s, got %d", p.Throughput)
+		}
+		return nil
+	}
+	if p.Throughput < 400 || p.Throughput%100 != 0 {
+		return fmt.Errorf("manual throughput must be at least 400 RU/s, in steps of 100, got %d", p.Throughput)
+	}
+	return nil
+}
+
+func (p provisioning) properties() azcosmos.ThroughputProperties {
+	if p.Autoscale {
+		return azcosmos.NewAutoscaleThroughputProperties(p.Throughput)
+	}
+	return azcosmos.NewManualThroughputProperties(p.Throughput)
+}
+
+func (p provisioning) String() string {
+	s := fmt.Sprintf("%d RU/s manual", p.Throughput)
+	if p.Autoscale {
+		s = fmt.Sprintf("autoscale up to %d RU/s", p.Throughput)
+	}
+	if p.Shared {
+		return s + " shared by the database"
+	}
+	return s + " per container"
+}
+
+// minAutoscaleThroughput is the lowest maximum autoscale can be set to.
+const minAutoscaleThroughput = 1000
+
+// provisioningFlags adds -shared, -autoscale and -throughput to fs, with
+// defaults from p. The returned function gives what was asked for once fs
+// is parsed.
+func provisioningFlags(fs *flag.FlagSet, p provisioning) func() provisioning {
+	shared := fs.Bool("shared", p.Shared, "provision throughput on new databases, shared by their containers, instead of on each container")
+	autoscale := fs.Bool("autoscale", p.Autoscale, "provision autoscale throughput, with -throughput as the maximum")
+	throughput := fs.Int("throughput", 0, fmt.Sprintf("RU/s to provision, or the maximum RU/s with -autoscale (default %d)", p.Throughput))
+	return func() provisioning {
+		prov := provisioning{Shared: *shared, Autoscale: *autoscale, Throughput: int32(*throughput)}
+		switch {
+		case prov.Throughput != 0:
+		case prov.Autoscale == p.Autoscale:
+			prov.Throughput = p.Throughput
+		case prov.Autoscale:
+			// switching to autoscale without a maximum starts at the lowest
+			prov.Throughput = minAutoscaleThroughput
+		default:
+			prov.Throughput = defaultProvisioning.Throughput
+		}
+		return prov
+	}
+}
+
+// offer is the throughput of a database or container. raw keeps every member
+// of the resource, so a replace sends back everything it read.
+type offer struct {
+	ID              string       `json:"id"`
+	OfferResourceID string       `json:"offerResourceId"`
+	Content         offerContent `json:"content"`
+
+	raw map[string]interface{}
+}
+
+type offerContent struct {
+	OfferThroughput        int32              `json:"offerThroughput,omitempty"`
+	OfferAutopilotSettings *autopilotSettings `json:"offerAutopilotSettings,omitempty"`
+}
+
+type autopilotSettings struct {
+	MaxThroughput int32 `json:"maxThroughput"`
+}
+
+func (c offerContent) autoscale() bool {
+	return c.OfferAutopilotSettings != nil
+}
+
+func (c offerContent) String() string {
+	if c.autoscale() {
+		return fmt.Sprintf("autoscale up to %d RU/s", c.OfferAutopilotSettings.MaxThroughput)
+	}
+	return fmt.Sprintf("%d RU/s manual", c.OfferThroughput)
+}
+
+// offerStatus is what the service reports alongside an offer it's asked for
+// directly.
+type offerStatus struct {
+	MinThroughput  int32
+	ReplacePending bool
+}
+
+func decodeOffer(b []byte) (offer, error) {
+	var o offer
+	if err := json.Unmarshal(b, &o); err != nil {
+		return o, err
+	}
+	return o, json.Unmarshal(b, &o.raw)
+}
+
+func readOfferStatus(resp *http.Response) offerStatus {
+	var status offerStatus
+	if n, err := strconv.ParseInt(resp.Header.Get("x-ms-cosmos-min-throughput"), 10, 32); err == nil {
+		status.MinThroughput = int32(n)
+	}
+	status.ReplacePending, _ = strconv.ParseBool(resp.Header.Get("x-ms-offer-replace-pending"))
+	return status
+}
+
+func (c *restClient) listOffers(ctx context.Context) ([]offer, error) {
+	var offers []offer
+	err := c.readFeed(ctx, "/offers", restResource{resourceType: "offers"}, func(page []byte) error {
+		feed := struct {
+			Offers []json.RawMessage `json:"Offers"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		for _, raw := range feed.Offers {
+			o, err := decodeOffer(raw)
+			if err != nil {
+				return err
+			}
+			offers = append(offers, o)
+		}
+		return nil
+	})
+	return offers, err
+}
+
+// readOffer reads one offer by id. Offers are addressed by resource id,
+// which key auth signs over in lower case.
+func (c *restClient) readOffer(ctx context.Context, id string) (offer, offerStatus, error) {
+	var raw json.RawMessage
+	resp, err := c.do(ctx, http.MethodGet, "/offers/"+id, restResource{resourceType: "offers", resourceLink: strings.ToLower(id)}, nil, nil, &raw)
+	if err != nil {
+		return offer{}, offerStatus{}, err
+	}
+	o, err := decodeOffer(raw)
+	return o, readOfferStatus(resp), err
+}
+
+// replaceOffer replaces the offer's content. headers carries the migration
+// header when switching between manual and autoscale.
+func (c *restClient) replaceOffer(ctx context.Context, o offer, content offerContent, headers map[string]string) (offer, offerStatus, error) {
+	body := map[string]interface{}{}
+	for k, v := range o.raw {
+		body[k] = v
+	}
+	body["content"] = content
+
+	var raw json.RawMessage
+	resp, err := c.do(ctx, http.MethodPut, "/offers/"+o.ID, restResource{resourceType: "offers", resourceLink: strings.ToLower(o.ID)}, headers, body, &raw)
+	if err != nil {
+		return offer{}, offerStatus{}, err
+	}
+	updated, err := decodeOffer(raw)
+	return updated, readOfferStatus(resp), err
+}
+
+// throughputRow is one database or container in `throughput show`.
+type throughputRow struct {
+	name   string
+	offer  *offer
+	status offerStatus
+	// shared is set for containers without an offer of their own in a
+	// database with one.
+	shared bool
+}
+
+// listThroughput returns a row for each database, followed by its
+// containers, picked by selectors. nil selectors picks everything.
+func listThroughput(ctx context.Context, rc *restClient, selectors []selector) ([]throughputRow, error) {
+	offers, err := rc.listOffers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byResource := map[string]*offer{}
+	for i := range offers {
+		byResource[offers[i].OfferResourceID] = &offers[i]
+	}
+
+	databases, err := rc.listDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rows []throughputRow
+	for _, db := range databases {
+		containers, err := rc.listContainers(ctx, db.ID)
+		if err != nil {
+			return nil, err
+		}
+		dbOffer := byResource[db.RID]
+		if selectors == nil || selectsDatabase(selectors, db.ID) {
+			rows = append(rows, throughputRow{name: db.ID, offer: dbOffer})
+		}
+		for _, c := range containers {
+			if selectors != nil && !selectsContainer(selectors, db.ID, c.ID) {
+				continue
+			}
+			o := byResource[c.RID]
+			rows = append(rows, throughputRow{name: db.ID + "/" + c.ID, offer: o, shared: o == nil && dbOffer != nil})
+		}
+	}
+
+	// the feed doesn't carry the minimum or whether a change is still being
+	// applied; reading each offer does
+	for i := range rows {
+		if rows[i].offer == nil {
+			continue
+		}
+		o, status, err := rc.readOffer(ctx, rows[i].offer.ID)
+		if err != nil {
+			return nil, err
+		}
+		rows[i].offer, rows[i].status = &o, status
+	}
+	return rows, nil
+}
+
+func printThroughput(rows []throughputRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE/CONTAINER\tMODE\tRU/S\tMAX RU/S\tMIN RU/S\t")
+	for _, r := range rows {
+		switch {
+		case r.shared:
+			fmt.Fprintf(w, "%s\tshared\t-\t-\t-\t\n", r.name)
+		case r.offer == nil:
+			// a database without shared throughput, or a serverless account
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t\n", r.name)
+		default:
+			c := r.offer.Content
+			mode, max := "manual", "-"
+			if c.autoscale() {
+				mode, max = "autoscale", strconv.Itoa(int(c.OfferAutopilotSettings.MaxThroughput))
+			}
+			note := ""
+			if r.status.ReplacePending {
+				note = "change pending"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\n", r.name, mode, c.OfferThroughput, max, r.status.MinThroughput, note)
+		}
+	}
+	w.Flush()
+}
+
+// findOffer returns the offer of a database, or of a container when
+// containerName is set.
+func findOffer(ctx context.Context, rc *restClient, databaseName, containerName string) (offer, error) {
+	rows, err := listThroughput(ctx, rc, []selector{{database: databaseName, container: containerName}})
+	if err != nil {
+		return offer{}, err
+	}
+	name := databaseName
+	if containerName != "" {
+		name += "/" + containerName
+	}
+	for _, r := range rows {
+		if r.name != name {
+			continue
+		}
+		if r.shared {
+			return offer{}, fmt.Errorf("%s has no throughput of its own, it shares %s's", name, databaseName)
+		}
+		if r.offer == nil {
+			return offer{}, fmt.Errorf("%s has no provisioned throughput", name)
+		}
+		return *r.offer, nil
+	}
+	return offer{}, fmt.Errorf("%s not found", name)
+}
+
+// setThroughput replaces the throughput of a database or container.
+// Switching between manual and autoscale is a migration, which the service
+// is asked for with a header rather than by the shape of the content alone.
+func setThroughput(ctx context.Context, rc *restClient, guard *safety, databaseName, containerName string, target provisioning) error {
+	name := databaseName
+	if containerName != "" {
+		name += "/" + containerName
+	}
+	current, err := findOffer(ctx, rc, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+
+	content := offerContent{OfferThroughput: target.Throughput}
+	if target.Autoscale {
+		content = offerContent{OfferAutopilotSettings: &autopilotSettings{MaxThroughput: target.Throughput}}
+	}
+	headers := map[string]string{}
+	switch {
+	case target.Autoscale && !current.Content.autoscale():
+		headers["x-ms-cosmos-migrate-offer-to-autopilot"] = "true"
+	case !target.Autoscale && current.Content.autoscale():
+		headers["x-ms-cosmos-migrate-offer-to-manual-throughput"] = "true"
+	}
+
+	ok, err := guard.allowWrite(fmt.Sprintf("change the throughput of %s from %v to %v", name, current.Content, content))
+	if !ok {
+		return err
+	}
+	updated, status, err := rc.replaceOffer(ctx, current, content, headers)
+	if err != nil {
+		if len(headers) > 0 {
+			return fmt.Errorf("switching %s between manual and autoscale: %w\nif the account doesn't accept the switch here, use the control plane, e.g. az cosmosdb sql container throughput migrate", name, err)
+		}
+		return err
+	}
+
+	fmt.Printf("Throughput of %s is now %v\n", name, updated.Content)
+	if status.ReplacePending {
+		fmt.Printf("The change is still being applied; scaling beyond the current partitions can take a while. Run `throughput show` to follow it.\n")
+	}
+	return nil
+}
+
+// runThroughputCommand implements `throughput show [selector...]` and
+// `throughput set (-manual n | -autoscale n) database[/container]`.
+func runThroughputCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: throughput show [database|database/container|pattern...] | throughput set (-manual n | -autoscale n) database[/container]"
+	fs := flag.NewFlagSet("throughput set", flag.ContinueOnError)
+	manual := fs.Int("manual", 0, "set manual throughput to this many RU/s")
+	autoscale := fs.Int("autoscale", 0, "set autoscale throughput with this maximum RU/s")
+	if len(args) == 0 || (args[0] != "show" && args[0] != "set") {
+		// lets -h print the flags of set
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return errors.New(usage)
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "show" {
+		var selectors []selector
+		if len(args) > 1 {
+			if selectors, err = parseSelectors(args[1:]); err != nil {
+				return err
+			}
+		}
+		rows, err := listThroughput(ctx, rc, selectors)
+		if err != nil {
+			return err
+		}
+		printThroughput(rows)
+		return nil
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (*manual == 0) == (*autoscale == 0) {
+		return errors.New(usage)
+	}
+	target := provisioning{Throughput: int32(*manual)}
+	if *autoscale != 0 {
+		target = provisioning{Autoscale: true, Throughput: int32(*autoscale)}
+	}
+	if err := target.validate(); err != nil {
+		return err
+	}
+	databaseName, containerName := splitContainerPath(fs.Arg(0))
+	return setThroughput(ctx, rc, newSafety(opts, p, rc), databaseName, containerName, target)
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// parseTTL parses a time to live as the CLI takes it: "off" for none, "on"
+// or "never" for -1, or a duration such as 90d, 36h or 3600 (seconds). On a
+// container -1 turns expiry on without expiring anything by default; on an
+// item it keeps the item forever.
+func parseTTL(s string) (*int32, error) {
+	var seconds int64
+	switch s {
+	case "off":
+		return nil, nil
+	case "on", "never", "-1":
+		seconds = -1
+	default:
+		var err error
+		if strings.HasSuffix(s, "d") {
+			var days int64
+			// 32 bits of days can't overflow once in seconds
+			days, err = strconv.ParseInt(strings.TrimSuffix(s, "d"), 10, 32)
+			seconds = days * secondsPerDay
+		} else if seconds, err = strconv.ParseInt(s, 10, 64); err != nil {
+			var d time.Duration
+			d, err = time.ParseDuration(s)
+			if err == nil && d%time.Second != 0 {
+				err = errors.New("not a whole number of seconds")
+			}
+			seconds = int64(d / time.Second)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad time to live %q, use off, on, or a duration such as 90d, 36h or 3600: %v", s, err)
+		}
+		if seconds <= 0 || seconds > math.MaxInt32 {
+			return nil, fmt.Errorf("time to live %q out of range, it must be between 1 second and about 68 years", s)
+		}
+	}
+	ttl := int32(seconds)
+	return &ttl, nil
+}
+
+// formatTTL is the reverse of parseTTL, for a container's default.
+func formatTTL(ttl *int32) string {
+	switch {
+	case ttl == nil:
+		return "off"
+	case *ttl == -1:
+		return "on, items set their own"
+	case *ttl%secondsPerDay == 0:
+		return fmt.Sprintf("%dd", *ttl/secondsPerDay)
+	case *ttl%3600 == 0:
+		return fmt.Sprintf("%dh", *ttl/3600)
+	}
+	return fmt.Sprintf("%ds", *ttl)
+}
+
+// ttlFlag adds a flag taking a parseTTL value to fs. The returned function
+// gives the value once fs is parsed, nil if the flag wasn't given.
+func ttlFlag(fs *flag.FlagSet, name, usage string) func() *int32 {
+	var ttl *int32
+	fs.Func(name, usage, func(s string) error {
+		v, err := parseTTL(s)
+		ttl = v
+		return err
+	})
+	return func() *int32 { return ttl }
+}
+
+// setDefaultTTL replaces the default time to live of a container. Turning it
+// off leaves items' own ttl in place but stops them expiring.
+func setDefaultTTL(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName string, ttl *int32) error {
+	container, properties, err := readContainerProperties(ctx, client, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	if formatTTL(properties.DefaultTimeToLive) == formatTTL(ttl) {
+		log.Printf("Time to live of %v\\%v is already %v\n", databaseName, containerName, formatTTL(ttl))
+		return nil
+	}
+	ok, err := guard.allowWrite(fmt.Sprintf("change the time to live of %v\\%v from %v to %v", databaseName, containerName, formatTTL(properties.DefaultTimeToLive), formatTTL(ttl)))
+	if !ok {
+		return err
+	}
+	properties.DefaultTimeToLive = ttl
+	resp, err := container.Replace(ctx, properties, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Time to live of %v\\%v is now %v. ActivityId %s. Consuming %v RU\n", databaseName, containerName, formatTTL(ttl), resp.ActivityID, resp.RequestCharge)
+	return nil
+}
+
+// setItemTTL sets or, with a nil ttl, removes the ttl member of one item.
+// It is replaced only if nobody changed it since it was read.
+func setItemTTL(ctx context.Context, client *azcosmos.Client, guard *safety, databaseName, containerName, partitionKey, id string, ttl *int32) error {
+	container, properties, err := readContainerProperties(ctx, client, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	if properties.DefaultTimeToLive == nil {
+		log.Printf("Time to live is off on %v\\%v, so the item won't expire until it is turned on with `ttl set on`\n", databaseName, containerName)
+	}
+
+	pk := azcosmos.NewPartitionKeyString(partitionKey)
+	resp, err := container.ReadItem(ctx, pk, id, nil)
+	if err != nil {
+		return err
+	}
+	item := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Value, &item); err != nil {
+		return err
+	}
+	if ttl == nil {
+		delete(item, "ttl")
+	} else {
+		item["ttl"] = *ttl
+	}
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	ok, err := guard.allowWrite(fmt.Sprintf("set the ttl of item [%v] in %v\\%v to %v", id, databaseName, containerName, itemTTLString(ttl)))
+	if !ok {
+		return err
+	}
+	etag := resp.ETag
+	replaced, err := container.ReplaceItem(ctx, pk, id, b, &azcosmos.ItemOptions{IfMatchEtag: &etag})
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("item [%v] changed while setting its ttl, try again: %w", id, err)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("ttl of item [%v] is now %v. ActivityId %s. Consuming %v RU\n", id, itemTTLString(ttl), replaced.ActivityID, replaced.RequestCharge)
+	return nil
+}
+
+func itemTTLString(ttl *int32) string {
+	switch {
+	case ttl == nil:
+		return "the container default"
+	case *ttl == -1:
+		return "never"
+	}
+	return formatTTL(ttl)
+}
+
+// expiryReport counts when the items of a container expire: an item expires
+// ttl seconds after it was last written (_ts), using its own ttl if it has
+// one and the container default otherwise.
+type expiryReport struct {
+	Days    int
+	Scanned int
+	// ByDay counts the items expiring on each date (UTC) within Days.
+	ByDay  map[string]int
+	ByType map[string]int
+	Later  int
+	Never  int
+}
+
+func newExpiryReport(days int) *expiryReport {
+	return &expiryReport{Days: days, ByDay: map[string]int{}, ByType: map[string]int{}}
+}
+
+// add counts one item. now is passed in so a report has one point in time.
+func (r *expiryReport) add(item map[string]interface{}, defaultTTL int32, now time.Time) {
+	r.Scanned++
+	ttl := int64(defaultTTL)
+	if v, ok := item["ttl"].(float64); ok {
+		ttl = int64(v)
+	}
+	ts, _ := item["_ts"].(float64)
+	if ttl <= 0 || ts == 0 {
+		r.Never++
+		return
+	}
+
+	expires := time.Unix(int64(ts)+ttl, 0).UTC()
+	if !expires.Before(now.AddDate(0, 0, r.Days)) {
+		r.Later++
+		return
+	}
+	r.ByDay[expires.Format("2006-01-02")]++
+	typ, _ := item["type"].(string)
+	if typ == "" {
+		typ = "(no type)"
+	}
+	r.ByType[typ]++
+}
+
+func (r *expiryReport) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Items scanned\t%d\n", r.Scanned)
+	days := make([]string, 0, len(r.ByDay))
+	total := 0
+	for day, n := range r.ByDay {
+		days = append(days, day)
+		total += n
+	}
+	sort.Strings(days)
+	fmt.Fprintf(w, "Expiring in the next %d days\t%d\n", r.Days, total)
+	for _, day := range days {
+		fmt.Fprintf(w, "  %s\t%d\n", day, r.ByDay[day])
+	}
+	types := make([]string, 0, len(r.ByType))
+	for typ := range r.ByType {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		fmt.Fprintf(w, "  of type %s\t%d\n", typ, r.ByType[typ])
+	}
+	fmt.Fprintf(w, "Expiring later\t%d\n", r.Later)
+	fmt.Fprintf(w, "Never expiring\t%d\n", r.Never)
+	w.Flush()
+}
+
+// reportExpiry reads every item of a container, across partitions, and
+// reports which will expire in the next days.
+func reportExpiry(ctx context.Context, client *azcosmos.Client, rc *restClient, databaseName, containerName string, days int) error {
+	_, properties, err := readContainerProperties(ctx, client, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Time to live of %v\\%v: %v\n", databaseName, containerName, formatTTL(properties.DefaultTimeToLive))
+	if properties.DefaultTimeToLive == nil {
+		fmt.Printf("Nothing expires while time to live is off, whatever ttl items set\n")
+		return nil
+	}
+
+	report := newExpiryReport(days)
+	now := time.Now().UTC()
+	err = rc.readItems(ctx, databaseName, containerName, func(raw json.RawMessage) error {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		report.add(item, *properties.DefaultTimeToLive, now)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	report.print()
+	return nil
+}
+
+// listTTL prints the default time to live of the containers the selectors
+// pick.
+func listTTL(ctx context.Context, rc *restClient, selectors []selector) error {
+	databases, err := rc.listDatabases(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "DATABASE\tCONTAINER\tTIME TO LIVE\n")
+	for _, db := range databases {
+		containers, err := rc.listContainers(ctx, db.ID)
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			if selectsContainer(selectors, db.ID, c.ID) {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", db.ID, c.ID, formatTTL(c.DefaultTTL))
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// runTTLCommand implements `ttl show [selector...]` and, for one container,
+// `ttl set value`, `ttl item -pk value id value` and `ttl report`.
+func runTTLCommand(ctx context.Context, opts globalOptions, args []string) error {
+	const usage = "usage: ttl show [database|database/container|pattern...] | ttl [-database name] [-container name] set (duration|on|off) | item -pk value id (duration|never|off) | report [-days n]"
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("ttl", flag.ContinueOnError)
+	databaseName := fs.String("database", p.database("database-v4"), "database of the container")
+	containerName := fs.String("container", p.container("customer"), "container whose time to live to change or report on")
+	partitionKey := fs.String("pk", "", "item: partition key value of the item")
+	days := fs.Int("days", 7, "report: how many days ahead to count expiring items")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// flags may also follow the subcommand, as in `ttl report -days 30`
+	sub := fs.Args()
+	if len(sub) == 0 {
+		return errors.New(usage)
+	}
+	if sub[0] == "show" {
+		selectors, err := parseSelectors(sub[1:])
+		if err != nil {
+			return err
+		}
+		rc, err := newRESTClient(p)
+		if err != nil {
+			return err
+		}
+		return listTTL(ctx, rc, selectors)
+	}
+	if err := fs.Parse(sub[1:]); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	guard := newSafety(opts, p, rc)
+
+	switch sub[0] {
+	case "set":
+		if len(rest) != 1 {
+			return errors.New(usage)
+		}
+		ttl, err := parseTTL(rest[0])
+		if err != nil {
+			return err
+		}
+		return setDefaultTTL(ctx, client, guard, *databaseName, *containerName, ttl)
+
+	case "item":
+		if len(rest) != 2 || *partitionKey == "" {
+			return errors.New(usage)
+		}
+		ttl, err := parseTTL(rest[1])
+		if err != nil {
+			return err
+		}
+		return setItemTTL(ctx, client, guard, *databaseName, *containerName, *partitionKey, rest[0], ttl)
+
+	case "report":
+		if len(rest) > 0 || *days < 1 {
+			return errors.New(usage)
+		}
+		return reportExpiry(ctx, client, rc, *databaseName, *containerName, *days)
+	}
+	return errors.New(usage)
+}
+
+// withTTL sets ttl on each of items, so they expire that many seconds after
+// they are written.
+func withTTL(items []map[string]interface{}, ttl int32) {
+	for _, item := range items {
+		item["ttl"] = ttl
+	}
+}
+
+func hasTTL(items []map[string]interface{}) bool {
+	for _, item := range items {
+		if _, ok := item["ttl"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// warnIfTTLOff warns that items given a ttl won't expire when time to live is
+// off on their container, which only its owner should decide to turn on.
+func warnIfTTLOff(ctx context.Context, rc *restClient, databaseName, containerName string) error {
+	info, err := rc.readContainer(ctx, databaseName, containerName)
+	if err != nil {
+		return err
+	}
+	if info.DefaultTTL == nil {
+		log.Printf("Warning: time to live is off on %v\\%v, so items won't expire until it is turned on with `ttl -database %v -container %v set on`\n", databaseName, containerName, databaseName, containerName)
+	}
+	return nil
+}
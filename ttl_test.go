@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int32
+		off     bool
+		wantErr string
+	}{
+		{in: "90d", want: 90 * secondsPerDay},
+		{in: "36h", want: 36 * 3600},
+		{in: "3600", want: 3600},
+		{in: "90s", want: 90},
+		{in: "1h30m", want: 5400},
+		{in: "off", off: true},
+		{in: "on", want: -1},
+		{in: "never", want: -1},
+		{in: "-1", want: -1},
+		{in: "24855d", want: 24855 * secondsPerDay},
+		{in: "2147483647", want: 2147483647},
+		{in: "1.5s", wantErr: "whole number of seconds"},
+		{in: "-5d", wantErr: "out of range"},
+		{in: "-60", wantErr: "out of range"},
+		{in: "0", wantErr: "out of range"},
+		{in: "0d", wantErr: "out of range"},
+		{in: "24856d", wantErr: "out of range"},
+		{in: "2147483648", wantErr: "out of range"},
+		{in: "99999999999d", wantErr: "bad time to live"},
+		{in: "ninety days", wantErr: "bad time to live"},
+		{in: "", wantErr: "bad time to live"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseTTL(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.off {
+				if got != nil {
+					t.Errorf("got %d, want off", *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("got %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTTL(t *testing.T) {
+	ttl := func(v int32) *int32 { return &v }
+	tests := []struct {
+		in   *int32
+		want string
+	}{
+		{in: nil, want: "off"},
+		{in: ttl(-1), want: "on, items set their own"},
+		{in: ttl(90 * secondsPerDay), want: "90d"},
+		{in: ttl(36 * 3600), want: "36h"},
+		{in: ttl(90), want: "90s"},
+	}
+	for _, tt := range tests {
+		if got := formatTTL(tt.in); got != tt.want {
+			t.Errorf("formatTTL(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+		// what formatTTL prints for a duration parses back to it
+		if tt.in != nil && *tt.in > 0 {
+			back, err := parseTTL(strings.TrimSuffix(tt.want, "s"))
+			if err != nil || *back != *tt.in {
+				t.Errorf("parseTTL(%q) = %v, %v, want %d", tt.want, back, err, *tt.in)
+			}
+		}
+	}
+}
+
+func TestExpiryReportAdd(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ts := float64(now.Unix())
+	r := newExpiryReport(7)
+	for _, item := range []map[string]interface{}{
+		// the container default, a day out
+		{"_ts": ts, "type": "customer"},
+		// its own ttl, two days out
+		{"_ts": ts, "type": "salesOrder", "ttl": float64(2 * secondsPerDay)},
+		// written a day ago with a two-day ttl, so a day out as well
+		{"_ts": ts - secondsPerDay, "type": "salesOrder", "ttl": float64(2 * secondsPerDay)},
+		// no type
+		{"_ts": ts, "ttl": float64(3600)},
+		// past the report's days
+		{"_ts": ts, "type": "salesOrder", "ttl": float64(30 * secondsPerDay)},
+		// exactly at the end of the report's days
+		{"_ts": ts, "type": "salesOrder", "ttl": float64(7 * secondsPerDay)},
+		// kept forever
+		{"_ts": ts, "type": "product", "ttl": float64(-1)},
+		// never written, as far as the report can tell
+		{"type": "product"},
+	} {
+		r.add(item, secondsPerDay, now)
+	}
+
+	want := &expiryReport{
+		Days:    7,
+		Scanned: 8,
+		ByDay:   map[string]int{"2024-03-01": 1, "2024-03-02": 2, "2024-03-03": 1},
+		ByType:  map[string]int{"customer": 1, "salesOrder": 2, "(no type)": 1},
+		Later:   2,
+		Never:   2,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got  %+v\nwant %+v", r, want)
+	}
+}
+
+func TestExpiryReportAddDefaultOn(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := newExpiryReport(7)
+	// with the default on (-1) only items with their own ttl expire
+	r.add(map[string]interface{}{"_ts": float64(now.Unix())}, -1, now)
+	r.add(map[string]interface{}{"_ts": float64(now.Unix()), "ttl": float64(60)}, -1, now)
+	if r.Never != 1 || r.ByDay["2024-03-01"] != 1 {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	items := []map[string]interface{}{{"id": "1"}, {"id": "2", "ttl": 5}}
+	if hasTTL(items[:1]) {
+		t.Fatal("hasTTL of an item without ttl")
+	}
+	withTTL(items, 60)
+	for _, item := range items {
+		if item["ttl"] != int32(60) {
+			t.Errorf("item %v has ttl %v, want 60", item["id"], item["ttl"])
+		}
+	}
+	if !hasTTL(items) {
+		t.Error("hasTTL after withTTL")
+	}
+}
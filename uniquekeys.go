@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// uniqueKeyFlag adds a repeatable flag taking the comma separated paths of
+// one unique key, e.g. -unique-key /emailAddress -unique-key /firstName,/lastName.
+// The returned function gives the keys once fs is parsed.
+func uniqueKeyFlag(fs *flag.FlagSet, name, usage string) func() [][]string {
+	var keys [][]string
+	fs.Func(name, usage, func(s string) error {
+		var paths []string
+		for _, path := range strings.Split(s, ",") {
+			path = strings.TrimSpace(path)
+			if !strings.HasPrefix(path, "/") || path == "/" {
+				return fmt.Errorf("bad unique key path %q, paths look like /emailAddress or /address/city", path)
+			}
+			paths = append(paths, path)
+		}
+		keys = append(keys, paths)
+		return nil
+	})
+	return func() [][]string { return keys }
+}
+
+func uniqueKeyPolicy(keys [][]string) *azcosmos.UniqueKeyPolicy {
+	if len(keys) == 0 {
+		return nil
+	}
+	policy := &azcosmos.UniqueKeyPolicy{}
+	for _, paths := range keys {
+		policy.UniqueKeys = append(policy.UniqueKeys, azcosmos.UniqueKey{Paths: paths})
+	}
+	return policy
+}
+
+func formatUniqueKeys(policy *azcosmos.UniqueKeyPolicy) string {
+	if policy == nil || len(policy.UniqueKeys) == 0 {
+		return "none"
+	}
+	var keys []string
+	for _, key := range policy.UniqueKeys {
+		keys = append(keys, "("+strings.Join(key.Paths, ", ")+")")
+	}
+	return strings.Join(keys, " ")
+}
+
+// valueAtPath returns the member of item at a path such as /address/city.
+func valueAtPath(item map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = item
+	for _, name := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// uniqueKeyValue is the value of one unique key of item, as JSON so it can
+// be compared. Like the service, a missing member counts as null, so only one
+// item in a partition may lack it.
+func uniqueKeyValue(item map[string]interface{}, paths []string) string {
+	values := make([]interface{}, len(paths))
+	for i, path := range paths {
+		values[i], _ = valueAtPath(item, path)
+	}
+	var b []byte
+	if len(values) == 1 {
+		b, _ = json.Marshal(values[0])
+	} else {
+		b, _ = json.Marshal(values)
+	}
+	return string(b)
+}
+
+// uniqueKeyChecker finds items that would violate a container's unique keys,
+// which the service enforces within each logical partition, named by every
+// path of a hierarchical key. Items are keyed by partition and id, so adding
+// an item again replaces it, as an upsert would.
+type uniqueKeyChecker struct {
+	policy            azcosmos.UniqueKeyPolicy
+	partitionKeyPaths []string
+	items             map[[2]string][]string
+}
+
+func newUniqueKeyChecker(policy azcosmos.UniqueKeyPolicy, partitionKeyPaths []string) *uniqueKeyChecker {
+	return &uniqueKeyChecker{policy: policy, partitionKeyPaths: partitionKeyPaths, items: map[[2]string][]string{}}
+}
+
+func (c *uniqueKeyChecker) add(item map[string]interface{}) {
+	// the partition key is compared as JSON the same way a unique key is
+	pk := uniqueKeyValue(item, c.partitionKeyPaths)
+	values := make([]string, len(c.policy.UniqueKeys))
+	for i, key := range c.policy.UniqueKeys {
+		values[i] = uniqueKeyValue(item, key.Paths)
+	}
+	c.items[[2]string{pk, fmt.Sprint(item["id"])}] = values
+}
+
+// uniqueKeyDuplicate is a set of items in one partition sharing the value of
+// a unique key.
+type uniqueKeyDuplicate struct {
+	PartitionKey string
+	Paths        []string
+	Value        string
+	IDs          []string
+}
+
+func (d uniqueKeyDuplicate) String() string {
+	return fmt.Sprintf("partition %s: %s = %s on items %s", d.PartitionKey, strings.Join(d.Paths, ", "), d.Value, strings.Join(d.IDs, ", "))
+}
+
+func (c *uniqueKeyChecker) duplicates() []uniqueKeyDuplicate {
+	type group struct {
+		partitionKey string
+		key          int
+		value        string
+	}
+	groups := map[group][]string{}
+	for item, values := range c.items {
+		for i, value := range values {
+			g := group{partitionKey: item[0], key: i, value: value}
+			groups[g] = append(groups[g], item[1])
+		}
+	}
+
+	var duplicates []uniqueKeyDuplicate
+	for g, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Strings(ids)
+		duplicates = append(duplicates, uniqueKeyDuplicate{
+			PartitionKey: g.partitionKey,
+			Paths:        c.policy.UniqueKeys[g.key].Paths,
+			Value:        g.value,
+			IDs:          ids,
+		})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].PartitionKey != duplicates[j].PartitionKey {
+			return duplicates[i].PartitionKey < duplicates[j].PartitionKey
+		}
+		return duplicates[i].String() < duplicates[j].String()
+	})
+	return duplicates
+}
+
+// uniqueKeyViolation is returned when a write is refused because another
+// item in the partition has the same value for a unique key.
+type uniqueKeyViolation struct {
+	ID     string
+	Values []string
+	err    error
+}
+
+func (e *uniqueKeyViolation) Error() string {
+	return fmt.Sprintf("item [%v] violates a unique key of the container: another item in its partition already has %s: %v", e.ID, strings.Join(e.Values, " or "), e.err)
+}
+
+func (e *uniqueKeyViolation) Unwrap() error {
+	return e.err
+}
+
+// explainConflict turns the conflict a write of item ran into into an error
+// that says whether an item with the same id exists or a unique key was
+// violated; the service answers 409 for both.
+func explainConflict(ctx context.Context, container *azcosmos.ContainerClient, pk azcosmos.PartitionKey, item map[string]interface{}, err error) error {
+	id := fmt.Sprint(item["id"])
+	if _, readErr := container.ReadItem(ctx, pk, id, nil); readErr == nil {
+		return fmt.Errorf("item [%v] already exists: %w", id, err)
+	}
+	return uniqueKeyConflict(ctx, container, item, err)
+}
+
+// uniqueKeyConflict describes the unique key values of an item whose write
+// conflicted other than on its id, as upserts and replaces do.
+func uniqueKeyConflict(ctx context.Context, container *azcosmos.ContainerClient, item map[string]interface{}, err error) error {
+	id := fmt.Sprint(item["id"])
+	resp, readErr := container.Read(ctx, nil)
+	if readErr != nil || resp.ContainerProperties == nil || resp.ContainerProperties.UniqueKeyPolicy == nil {
+		return fmt.Errorf("item [%v] conflicts with an existing item: %w", id, err)
+	}
+	violation := &uniqueKeyViolation{ID: id, err: err}
+	for _, key := range resp.ContainerProperties.UniqueKeyPolicy.UniqueKeys {
+		violation.Values = append(violation.Values, strings.Join(key.Paths, ", ")+" = "+uniqueKeyValue(item, key.Paths))
+	}
+	return violation
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+func TestUniqueKeyCheckerDuplicates(t *testing.T) {
+	policy := azcosmos.UniqueKeyPolicy{UniqueKeys: []azcosmos.UniqueKey{
+		{Paths: []string{"/emailAddress"}},
+		{Paths: []string{"/firstName", "/lastName"}},
+	}}
+	tests := []struct {
+		name  string
+		paths []string
+		items []map[string]interface{}
+		want  []uniqueKeyDuplicate
+	}{
+		{
+			name:  "same partition",
+			paths: []string{"/customerId"},
+			items: []map[string]interface{}{
+				{"id": "1", "customerId": "c1", "emailAddress": "a@example.com", "firstName": "A", "lastName": "B"},
+				{"id": "2", "customerId": "c1", "emailAddress": "a@example.com", "firstName": "C", "lastName": "B"},
+				{"id": "3", "customerId": "c2", "emailAddress": "a@example.com", "firstName": "A", "lastName": "B"},
+			},
+			want: []uniqueKeyDuplicate{
+				{PartitionKey: `"c1"`, Paths: []string{"/emailAddress"}, Value: `"a@example.com"`, IDs: []string{"1", "2"}},
+			},
+		},
+		{
+			name:  "adding an item again replaces it",
+			paths: []string{"/customerId"},
+			items: []map[string]interface{}{
+				{"id": "1", "customerId": "c1", "emailAddress": "a@example.com"},
+				{"id": "2", "customerId": "c1", "emailAddress": "b@example.com"},
+				{"id": "2", "customerId": "c1", "emailAddress": "a@example.com"},
+			},
+			want: []uniqueKeyDuplicate{
+				{PartitionKey: `"c1"`, Paths: []string{"/emailAddress"}, Value: `"a@example.com"`, IDs: []string{"1", "2"}},
+				{PartitionKey: `"c1"`, Paths: []string{"/firstName", "/lastName"}, Value: "[null,null]", IDs: []string{"1", "2"}},
+			},
+		},
+		{
+			name:  "hierarchical partitions differ below the first level",
+			paths: []string{"/tenantId", "/userId"},
+			items: []map[string]interface{}{
+				{"id": "1", "tenantId": "t1", "userId": "u1", "emailAddress": "a@example.com", "firstName": "A", "lastName": "B"},
+				{"id": "2", "tenantId": "t1", "userId": "u2", "emailAddress": "a@example.com", "firstName": "A", "lastName": "B"},
+			},
+		},
+		{
+			name:  "hierarchical partition shared",
+			paths: []string{"/tenantId", "/userId"},
+			items: []map[string]interface{}{
+				{"id": "1", "tenantId": "t1", "userId": "u1", "emailAddress": "a@example.com", "firstName": "A", "lastName": "B"},
+				{"id": "2", "tenantId": "t1", "userId": "u1", "emailAddress": "b@example.com", "firstName": "A", "lastName": "B"},
+			},
+			want: []uniqueKeyDuplicate{
+				{PartitionKey: `["t1","u1"]`, Paths: []string{"/firstName", "/lastName"}, Value: `["A","B"]`, IDs: []string{"1", "2"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := newUniqueKeyChecker(policy, tt.paths)
+			for _, item := range tt.items {
+				checker.add(item)
+			}
+			if got := checker.duplicates(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
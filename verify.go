@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// customerPartition tallies one customerId partition of the v4 customer
+// container: the customer document, if any, and its sales orders.
+type customerPartition struct {
+	customer map[string]interface{}
+	etag     string
+	recorded float64
+	orders   int
+}
+
+// scanCustomerPartitions reads the whole customer container and groups its
+// documents by partition.
+func scanCustomerPartitions(ctx context.Context, rc *restClient, databaseName, containerName string) (map[string]*customerPartition, error) {
+	partitions := map[string]*customerPartition{}
+	err := rc.readItems(ctx, databaseName, containerName, func(raw json.RawMessage) error {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		customerID, _ := item["customerId"].(string)
+		p, ok := partitions[customerID]
+		if !ok {
+			p = &customerPartition{}
+			partitions[customerID] = p
+		}
+
+		switch item["type"] {
+		case "customer":
+			p.etag, _ = item["_etag"].(string)
+			p.recorded, _ = item["salesOrderCount"].(float64)
+			for _, name := range systemProperties {
+				delete(item, name)
+			}
+			p.customer = item
+		case "salesOrder":
+			p.orders++
+		}
+		return nil
+	})
+	return partitions, err
+}
+
+// fixSalesOrderCount sets the customer's salesOrderCount to the number of
+// orders found. The replace is sent as a transactional batch conditioned on
+// the ETag seen during the scan, so a customer that changed since then is
+// left alone rather than overwritten with a stale count.
+func fixSalesOrderCount(ctx context.Context, container *azcosmos.ContainerClient, customerID string, p *customerPartition) error {
+	p.customer["salesOrderCount"] = float64(p.orders)
+	customerJSON, err := json.Marshal(p.customer)
+	if err != nil {
+		return err
+	}
+
+	etag := azcore.ETag(p.etag)
+	batch := container.NewTransactionalBatch(azcosmos.NewPartitionKeyString(customerID))
+	batch.ReplaceItem(customerID, customerJSON, &azcosmos.TransactionalBatchItemOptions{IfMatchETag: &etag})
+	batchResponse, err := container.ExecuteTransactionalBatch(ctx, batch, nil)
+	if err != nil {
+		return err
+	}
+	if batchResponse.Success {
+		return nil
+	}
+	if len(batchResponse.OperationResults) == 0 {
+		return errors.New("ExecuteTransactionalBatch failed")
+	}
+	if status := batchResponse.OperationResults[0].StatusCode; status != http.StatusPreconditionFailed {
+		return fmt.Errorf("replace failed with status code %v", status)
+	}
+	return errors.New("customer changed since the scan, run verify again")
+}
+
+// verifySalesOrderCounts compares each customer's salesOrderCount with the
+// number of salesOrder documents in its partition, reporting mismatches and
+// orders without a customer. With fix, mismatched counts are repaired. It
+// returns the number of problems found.
+func verifySalesOrderCounts(ctx context.Context, client *azcosmos.Client, rc *restClient, guard *safety, databaseName, containerName string, fix bool) (int, error) {
+	partitions, err := scanCustomerPartitions(ctx, rc, databaseName, containerName)
+	if err != nil {
+		return 0, err
+	}
+
+	customerIDs := make([]string, 0, len(partitions))
+	for id := range partitions {
+		customerIDs = append(customerIDs, id)
+	}
+	sort.Strings(customerIDs)
+
+	container, err := client.NewContainer(databaseName, containerName)
+	if err != nil {
+		return 0, err
+	}
+
+	problems := 0
+	for _, customerID := range customerIDs {
+		p := partitions[customerID]
+		if p.customer == nil {
+			if p.orders > 0 {
+				fmt.Printf("customer [%v]: %d sales orders but no customer document\n", customerID, p.orders)
+				problems++
+			}
+			continue
+		}
+		if int(p.recorded) == p.orders {
+			continue
+		}
+
+		fmt.Printf("customer [%v]: salesOrderCount is %v, found %d sales orders\n", customerID, p.recorded, p.orders)
+		problems++
+		if !fix {
+			continue
+		}
+		ok, err := guard.allowWrite(fmt.Sprintf("set salesOrderCount of customer [%v] to %d", customerID, p.orders))
+		if err != nil {
+			return problems, err
+		}
+		if !ok {
+			continue
+		}
+		if err := fixSalesOrderCount(ctx, container, customerID, p); err != nil {
+			log.Printf("Could not fix customer [%v]: %v\n", customerID, err)
+			continue
+		}
+		fmt.Printf("customer [%v]: salesOrderCount set to %d\n", customerID, p.orders)
+	}
+
+	fmt.Printf("Checked %d customer partitions in %v\\%v, %d problems\n", len(partitions), databaseName, containerName, problems)
+	return problems, nil
+}
+
+// runVerifyCommand implements `verify [-fix]`.
+func runVerifyCommand(ctx context.Context, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "repair mismatched salesOrderCount values")
+	databaseName := fs.String("database", "database-v4", "database holding the customer container")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: verify [-fix] [-database name]")
+	}
+
+	p, err := opts.resolveProfile()
+	if err != nil {
+		return err
+	}
+	rc, err := newRESTClient(p)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	problems, err := verifySalesOrderCounts(ctx, client, rc, newSafety(opts, p, rc), *databaseName, "customer", *fix)
+	if err != nil {
+		return err
+	}
+	if problems > 0 && !*fix {
+		return fmt.Errorf("%d problems found, run with -fix to repair salesOrderCount", problems)
+	}
+	return nil
+}
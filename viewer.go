@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// viewerPageSize is how many items the interactive viewer shows at a time.
+const viewerPageSize = 10
+
+// pageFetcher fetches the page of results that starts at continuation.
+type pageFetcher func(ctx context.Context, continuation string) (queryPage, error)
+
+// summaryFields are shown, when present, in the one-line summary of an item.
+var summaryFields = []string{"id", "type", "sku", "name", "firstName", "lastName", "categoryName", "orderDate", "price", "salesOrderCount"}
+
+// summarizeItem renders an item on a single line.
+func summarizeItem(item map[string]interface{}) string {
+	var parts []string
+	for _, field := range summaryFields {
+		if v, ok := item[field]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%v", field, v))
+		}
+	}
+	if details, ok := item["details"].([]interface{}); ok {
+		parts = append(parts, fmt.Sprintf("lines=%d", len(details)))
+	}
+	return truncate(strings.Join(parts, "  "), 110)
+}
+
+// truncate shortens s to at most width characters, ending in "..." if it
+// had to cut. It counts and cuts runes, never splitting a UTF-8 sequence.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-3]) + "..."
+}
+
+// isTerminal reports whether stdout is a terminal, so escape codes are only
+// sent where they mean something.
+func isTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func clearScreen() {
+	if isTerminal() {
+		fmt.Print("\033[H\033[2J")
+	}
+}
+
+// viewPages shows query results one page at a time, with each item on one
+// line. Pages already seen are kept, so going back doesn't query again.
+func viewPages(ctx context.Context, title string, fetch pageFetcher) error {
+	var pages []queryPage
+	current := -1
+	next := func() error {
+		if current+1 < len(pages) {
+			current++
+			return nil
+		}
+		continuation := ""
+		if current >= 0 {
+			continuation = pages[current].Continuation
+		}
+		page, err := fetch(ctx, continuation)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page)
+		current++
+		return nil
+	}
+	if err := next(); err != nil {
+		return err
+	}
+
+	for {
+		page := pages[current]
+		first := 0
+		for _, p := range pages[:current] {
+			first += len(p.Items)
+		}
+		clearScreen()
+		fmt.Printf("%s\n", title)
+		fmt.Printf("Page %d, %v RU\n\n", current+1, page.RequestCharge)
+		if len(page.Items) == 0 {
+			fmt.Printf("  (no items)\n")
+		}
+		for i, item := range page.Items {
+			fmt.Printf("%4d  %s\n", first+i+1, summarizeItem(item))
+		}
+
+		more := page.Continuation != ""
+		fmt.Printf("\n")
+		if more {
+			fmt.Printf("[n] next  ")
+		}
+		if current > 0 {
+			fmt.Printf("[p] previous  ")
+		}
+		fmt.Printf("[number] show item  [q] back to menu\n> ")
+
+		input, err := readLine(ctx)
+		if err != nil {
+			return err
+		}
+		switch input {
+		// enter pages forward, and returns to the menu from the last page
+		case "n", "":
+			if !more {
+				if input == "" {
+					return nil
+				}
+				continue
+			}
+			if err := next(); err != nil {
+				return err
+			}
+		case "p":
+			if current > 0 {
+				current--
+			}
+		case "q":
+			return nil
+		default:
+			n, err := strconv.Atoi(input)
+			if err != nil || n <= first || n > first+len(page.Items) {
+				continue
+			}
+			if err := showItem(ctx, page.Items[n-first-1]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// showItem prints an item in full and waits for enter.
+func showItem(ctx context.Context, item map[string]interface{}) error {
+	b, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		return err
+	}
+	clearScreen()
+	fmt.Printf("%s\n\nPress enter to return ", b)
+	_, err = readLine(ctx)
+	return err
+}